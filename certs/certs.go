@@ -0,0 +1,201 @@
+// Package certs generates the certificates for serving over HTTPS without a
+// certificate from a public CA: a local CA, created once, and a leaf
+// certificate for the served host names signed by it. Trusting the CA
+// certificate on a device makes every leaf it signs trusted there.
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Names of the files in the certificate directory
+const (
+	caFile    = "ca.pem"
+	caKeyFile = "ca-key.pem"
+	certFile  = "cert.pem"
+	keyFile   = "key.pem"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 397 * 24 * time.Hour // The longest validity browsers accept
+	leafRenewal  = 30 * 24 * time.Hour  // Renew leaf certificates this long before they expire
+)
+
+// Paths of the generated files
+type Paths struct {
+	CA   string // CA certificate, to install on devices that should trust the server
+	Cert string
+	Key  string
+}
+
+// Ensure returns a certificate and key in dir that are valid for hosts (names
+// or IP addresses), creating the CA and the leaf certificate as needed. An
+// existing leaf is reused while it covers every host and isn't about to
+// expire. localhost and the loopback addresses are always included.
+func Ensure(dir string, hosts []string) (Paths, error) {
+	paths := Paths{
+		CA:   filepath.Join(dir, caFile),
+		Cert: filepath.Join(dir, certFile),
+		Key:  filepath.Join(dir, keyFile),
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return paths, err
+	}
+
+	ca, caKey, err := loadOrCreateCA(paths.CA, filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return paths, err
+	}
+
+	hosts = append([]string{"localhost", "127.0.0.1", "::1"}, hosts...)
+	if leafValid(paths.Cert, paths.Key, ca, hosts) {
+		return paths, nil
+	}
+	return paths, createLeaf(paths.Cert, paths.Key, ca, caKey, hosts)
+}
+
+// loadOrCreateCA loads the CA certificate and key, creating them if either is missing
+func loadOrCreateCA(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	if pair, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", certPath, err)
+		}
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: unsupported key type", keyPath)
+		}
+		if time.Now().Before(cert.NotAfter) {
+			return cert, key, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("load CA: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"mdserver local CA"},
+			CommonName:   "mdserver CA " + hostname,
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	cert, err := createCertificate(certPath, keyPath, template, nil, key, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create CA: %w", err)
+	}
+	return cert, key, nil
+}
+
+// leafValid reports whether the leaf certificate in certPath is usable: it
+// matches its key, was signed by ca, covers hosts, and isn't about to expire
+func leafValid(certPath, keyPath string, ca *x509.Certificate, hosts []string) bool {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+	if time.Now().Add(leafRenewal).After(cert.NotAfter) || cert.CheckSignatureFrom(ca) != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// createLeaf creates a server certificate for hosts signed by the CA
+func createLeaf(certPath, keyPath string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"mdserver"},
+			CommonName:   hosts[0],
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(leafValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if _, err := createCertificate(certPath, keyPath, template, ca, key, caKey); err != nil {
+		return fmt.Errorf("create certificate: %w", err)
+	}
+	return nil
+}
+
+// createCertificate signs template (self-signed when parent is nil) and writes
+// the certificate and key as PEM files
+func createCertificate(certPath, keyPath string, template, parent *x509.Certificate, key, signer *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	if parent == nil {
+		parent = template
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writePEM(keyPath, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return nil, err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), perm)
+}
@@ -0,0 +1,88 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readCert(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s: no PEM data", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return cert
+}
+
+func TestEnsure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	paths, err := Ensure(dir, []string{"docs.example.test", "192.168.1.20"})
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+
+	ca := readCert(t, paths.CA)
+	if !ca.IsCA {
+		t.Error("CA certificate should be a CA")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	leaf := readCert(t, paths.Cert)
+	for _, host := range []string{"docs.example.test", "192.168.1.20", "localhost", "127.0.0.1", "::1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("Certificate doesn't verify for %s: %v", host, err)
+		}
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "other.example.test", Roots: roots}); err == nil {
+		t.Error("Certificate shouldn't be valid for other hosts")
+	}
+
+	if info, err := os.Stat(paths.Key); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Key file should only be readable by its owner, got %v (%v)", info.Mode().Perm(), err)
+	}
+}
+
+func TestEnsureReusesCertificates(t *testing.T) {
+	dir := t.TempDir()
+	first, err := Ensure(dir, []string{"a.example.test"})
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	caPEM, _ := os.ReadFile(first.CA)
+	certPEM, _ := os.ReadFile(first.Cert)
+
+	// Same hosts: nothing changes
+	if _, err := Ensure(dir, []string{"a.example.test"}); err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if again, _ := os.ReadFile(first.Cert); !bytes.Equal(again, certPEM) {
+		t.Error("Certificate should be reused for the same hosts")
+	}
+
+	// New host: a new leaf from the same CA
+	second, err := Ensure(dir, []string{"b.example.test"})
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if again, _ := os.ReadFile(second.CA); !bytes.Equal(again, caPEM) {
+		t.Error("CA should be reused")
+	}
+	if again, _ := os.ReadFile(second.Cert); bytes.Equal(again, certPEM) {
+		t.Error("Certificate should be reissued for new hosts")
+	}
+	if err := readCert(t, second.Cert).VerifyHostname("b.example.test"); err != nil {
+		t.Errorf("Reissued certificate: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+// Package config loads mdserver settings from YAML config files and merges
+// them with command line flags.
+//
+// Config file keys are flag names. Nested mappings are joined with "-", so
+//
+//	tls:
+//	  cert: cert.pem
+//
+// sets --tls-cert. Lists set a flag once per element.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the name of the config file looked up in the served directory
+const ProjectFile = ".mdserver.yaml"
+
+// Sources of a setting's value, besides the path of a config file
+const (
+	SourceDefault = "default"
+	SourceFlag    = "flag"
+)
+
+// File is a parsed config file
+type File struct {
+	Path    string
+	Values  map[string]any // Flag name -> value, nested keys already joined
+	Project bool           // Comes with the served docs, so Options.UserOnly flags can't be set
+}
+
+// Load reads a config file. It returns nil without an error if the file
+// doesn't exist.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]any)
+	flatten("", raw, values)
+	return &File{Path: path, Values: values}, nil
+}
+
+// flatten copies m into values, joining nested mapping keys with "-"
+func flatten(prefix string, m map[string]any, values map[string]any) {
+	for key, value := range m {
+		if prefix != "" {
+			key = prefix + "-" + key
+		}
+		if nested, ok := value.(map[string]any); ok {
+			flatten(key, nested, values)
+			continue
+		}
+		values[key] = value
+	}
+}
+
+// ProjectPath returns the path of the project config file in rootDir
+func ProjectPath(rootDir string) string {
+	return filepath.Join(rootDir, ProjectFile)
+}
+
+// UserDir returns the per-user mdserver directory, $XDG_CONFIG_HOME/mdserver
+// (~/.config when XDG_CONFIG_HOME is unset)
+func UserDir() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "mdserver"), nil
+}
+
+// UserPath returns the path of the user config file, config.yaml in UserDir
+func UserPath() (string, error) {
+	dir, err := UserDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Options controls how config file values are applied to flags
+type Options struct {
+	// Exclude lists flags that can't be set from a config file
+	Exclude map[string]bool
+	// UserOnly lists flags that can't be set from a project file, only from
+	// the user's config file and the command line
+	UserOnly map[string]bool
+	// Paths lists flags whose relative values are resolved against the
+	// directory of the config file that sets them
+	Paths map[string]bool
+}
+
+// Apply sets each flag in fs that wasn't given on the command line from the
+// first file (in order of precedence) that has a value for it. Nil files are
+// skipped. It returns the source of every flag's value: SourceFlag,
+// SourceDefault, or the path of a config file.
+func Apply(fs *flag.FlagSet, files []*File, opts Options) (map[string]string, error) {
+	sources := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		sources[f.Name] = SourceDefault
+	})
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = SourceFlag
+	})
+
+	for _, file := range files {
+		if file == nil {
+			continue
+		}
+		// Apply in a fixed order so errors are reproducible
+		keys := make([]string, 0, len(file.Values))
+		for key := range file.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if fs.Lookup(key) == nil {
+				return nil, fmt.Errorf("%s: unknown setting %q", file.Path, key)
+			}
+			if opts.Exclude[key] {
+				return nil, fmt.Errorf("%s: %q can't be set in a config file", file.Path, key)
+			}
+			if opts.UserOnly[key] && file.Project {
+				return nil, fmt.Errorf("%s: %q can only be set on the command line or in the user config file", file.Path, key)
+			}
+			if sources[key] != SourceDefault {
+				continue // Set by a flag or a file with higher precedence
+			}
+			if err := setFlag(fs, key, file.Values[key], file.Path, opts.Paths[key]); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", file.Path, key, err)
+			}
+			sources[key] = file.Path
+		}
+	}
+	return sources, nil
+}
+
+// setFlag sets a flag from a decoded YAML value. Lists set the flag once per element.
+func setFlag(fs *flag.FlagSet, name string, value any, configPath string, isPath bool) error {
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if _, ok := v.(map[string]any); ok {
+			return errors.New("expected a value, not a mapping")
+		}
+		s := fmt.Sprint(v)
+		if isPath && s != "" && !filepath.IsAbs(s) {
+			s = filepath.Join(filepath.Dir(configPath), s)
+		}
+		if err := fs.Set(name, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
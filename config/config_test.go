@@ -0,0 +1,176 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// listFlag is a repeatable flag for testing list values
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(s string) error { *l = append(*l, s); return nil }
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func load(t *testing.T, path string) *File {
+	t.Helper()
+	file, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load(%s) error = %v", path, err)
+	}
+	return file
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.yaml", "host: 0.0.0.0\nport: 9000\ntls:\n  cert: cert.pem\n  key: key.pem\nignore: [drafts, '*.tmp']\n")
+
+	file := load(t, path)
+	want := map[string]any{
+		"host":     "0.0.0.0",
+		"port":     9000,
+		"tls-cert": "cert.pem",
+		"tls-key":  "key.pem",
+	}
+	for key, value := range want {
+		if file.Values[key] != value {
+			t.Errorf("Values[%q] = %#v, want %#v", key, file.Values[key], value)
+		}
+	}
+	if list, ok := file.Values["ignore"].([]any); !ok || len(list) != 2 {
+		t.Errorf("Values[ignore] = %#v, want a two element list", file.Values["ignore"])
+	}
+
+	if file, err := Load(filepath.Join(dir, "missing.yaml")); file != nil || err != nil {
+		t.Errorf("Load(missing) = %v, %v; want nil, nil", file, err)
+	}
+
+	bad := writeConfig(t, dir, "bad.yaml", "host: [unclosed\n")
+	if _, err := Load(bad); err == nil {
+		t.Error("Expected error for invalid YAML")
+	}
+}
+
+func TestApplyPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	project := load(t, writeConfig(t, dir, "project/.mdserver.yaml", "port: 9000\ntheme: dark\ntemplate-dir: templates\n"))
+	user := load(t, writeConfig(t, dir, "user/config.yaml", "port: 7000\ntheme: light\nhost: example.test\nignore: [a, b]\n"))
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	host := fs.String("host", "localhost", "")
+	port := fs.Int("port", 0, "")
+	theme := fs.String("theme", "auto", "")
+	templateDir := fs.String("template-dir", "", "")
+	verbose := fs.Bool("verbose", false, "")
+	var ignore listFlag
+	fs.Var(&ignore, "ignore", "")
+	if err := fs.Parse([]string{"--theme", "auto"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := Apply(fs, []*File{project, user, nil}, Options{
+		Paths: map[string]bool{"template-dir": true},
+	})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		got, want  any
+		wantSource string
+	}{
+		{"theme", *theme, "auto", SourceFlag},
+		{"port", *port, 9000, project.Path},
+		{"template-dir", *templateDir, filepath.Join(dir, "project", "templates"), project.Path},
+		{"host", *host, "example.test", user.Path},
+		{"ignore", ignore.String(), "a,b", user.Path},
+		{"verbose", *verbose, false, SourceDefault},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+		if sources[tt.name] != tt.wantSource {
+			t.Errorf("source of %s = %q, want %q", tt.name, sources[tt.name], tt.wantSource)
+		}
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown setting", "colour: red\n", `unknown setting "colour"`},
+		{"excluded setting", "dir: /tmp\n", `"dir" can't be set in a config file`},
+		{"invalid value", "port: many\n", "port"},
+		{"mapping value", "port:\n  number:\n    value: 1\n", `unknown setting "port-number-value"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := load(t, writeConfig(t, dir, tt.name+".yaml", tt.content))
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Int("port", 0, "")
+			fs.String("dir", ".", "")
+			_, err := Apply(fs, []*File{file}, Options{Exclude: map[string]bool{"dir": true}})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Apply() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyUserOnly(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{UserOnly: map[string]bool{"auth": true}}
+	newFlags := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("auth", "auto", "")
+		return fs
+	}
+
+	project := load(t, writeConfig(t, dir, "project.yaml", "auth: none\n"))
+	project.Project = true
+	_, err := Apply(newFlags(), []*File{project}, opts)
+	if err == nil || !strings.Contains(err.Error(), `"auth" can only be set on the command line or in the user config file`) {
+		t.Errorf("Apply() error = %v, want the project file rejected", err)
+	}
+
+	user := load(t, writeConfig(t, dir, "user.yaml", "auth: none\n"))
+	fs := newFlags()
+	if _, err := Apply(fs, []*File{nil, user}, opts); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := fs.Lookup("auth").Value.String(); got != "none" {
+		t.Errorf("auth = %q, want none from the user file", got)
+	}
+}
+
+func TestUserPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	path, err := UserPath()
+	if err != nil {
+		t.Fatalf("UserPath() error = %v", err)
+	}
+	if want := filepath.Join("/xdg", "mdserver", "config.yaml"); path != want {
+		t.Errorf("UserPath() = %q, want %q", path, want)
+	}
+}
@@ -0,0 +1,90 @@
+//go:build ignore
+
+// fetch downloads the pinned library files into files/ and checks them
+// against the checksums in sums.go. Run it with "go generate ./libs". After
+// changing a version in libs.go, run "go run fetch.go -update" to record the
+// checksums of the new files instead.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mdserver/libs"
+)
+
+func main() {
+	update := flag.Bool("update", false, "Record the checksums of the downloaded files in sums.go instead of checking them")
+	flag.Parse()
+
+	// Download everything before touching files/, so a failure leaves it as it was
+	downloaded := make(map[string][]byte)
+	sums := make(map[string]string)
+	for _, path := range libs.Files() {
+		var data []byte
+		var err error
+		if *update {
+			data, err = libs.Download(path)
+		} else {
+			data, err = libs.Fetch(path)
+		}
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		downloaded[path] = data
+		sum := sha256.Sum256(data)
+		sums[path] = hex.EncodeToString(sum[:])
+		log.Printf("fetched %s", path)
+	}
+
+	if err := os.RemoveAll("files"); err != nil {
+		log.Fatal(err)
+	}
+	for path, data := range downloaded {
+		if err := write(path, data); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+	readme := "Library files embedded by package libs. Generated by \"go generate ./libs\"; don't edit.\n"
+	if err := os.WriteFile(filepath.Join("files", "README.md"), []byte(readme), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if *update {
+		if err := writeSums(sums); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("recorded %d checksums in sums.go; review them before committing", len(sums))
+	}
+}
+
+// write stores a library file under files/
+func write(path string, data []byte) error {
+	dst := filepath.Join("files", filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// writeSums generates sums.go
+func writeSums(sums map[string]string) error {
+	var b strings.Builder
+	b.WriteString("// Code generated by \"go run fetch.go -update\"; DO NOT EDIT.\n\npackage libs\n\n")
+	b.WriteString("// sums are the SHA-256 checksums of the library files, by path\nvar sums = map[string]string{\n")
+	for _, path := range libs.Files() {
+		fmt.Fprintf(&b, "\t%q: %q,\n", path, sums[path])
+	}
+	b.WriteString("}\n")
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile("sums.go", src, 0644)
+}
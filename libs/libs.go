@@ -0,0 +1,155 @@
+// Package libs embeds pinned versions of the client-side libraries pages use
+// (Mermaid and KaTeX), so pages work without network access.
+//
+// The files live under files/ with the same layout as /assets/vendor/ and are
+// fetched from the npm CDN with "go generate ./libs", which checks them against
+// the SHA-256 checksums pinned in sums.go. After changing a version, run
+// "go run fetch.go -update" in this directory to record the new checksums, and
+// review and commit them together with the files. A build without the files
+// still works: Read reports them as missing and callers fall back to CDNURL,
+// or download them with Fetch.
+package libs
+
+//go:generate go run fetch.go
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Pinned library versions
+const (
+	MermaidVersion = "10.9.1"
+	KaTeXVersion   = "0.16.11"
+)
+
+// Paths of the files pages load, relative to /assets/vendor/
+const (
+	MermaidJS = "mermaid@" + MermaidVersion + "/mermaid.min.js"
+	KaTeXJS   = "katex@" + KaTeXVersion + "/katex.min.js"
+	KaTeXCSS  = "katex@" + KaTeXVersion + "/katex.min.css"
+)
+
+// katexFonts are the fonts katex.min.css references. Only the woff2 variants
+// are bundled; every browser that runs KaTeX supports them.
+var katexFonts = []string{
+	"KaTeX_AMS-Regular",
+	"KaTeX_Caligraphic-Bold",
+	"KaTeX_Caligraphic-Regular",
+	"KaTeX_Fraktur-Bold",
+	"KaTeX_Fraktur-Regular",
+	"KaTeX_Main-Bold",
+	"KaTeX_Main-BoldItalic",
+	"KaTeX_Main-Italic",
+	"KaTeX_Main-Regular",
+	"KaTeX_Math-BoldItalic",
+	"KaTeX_Math-Italic",
+	"KaTeX_SansSerif-Bold",
+	"KaTeX_SansSerif-Italic",
+	"KaTeX_SansSerif-Regular",
+	"KaTeX_Script-Regular",
+	"KaTeX_Size1-Regular",
+	"KaTeX_Size2-Regular",
+	"KaTeX_Size3-Regular",
+	"KaTeX_Size4-Regular",
+	"KaTeX_Typewriter-Regular",
+}
+
+//go:embed files
+var files embed.FS
+
+// Files returns the paths of all library files, relative to /assets/vendor/
+func Files() []string {
+	paths := []string{MermaidJS, KaTeXJS, KaTeXCSS}
+	for _, font := range katexFonts {
+		paths = append(paths, "katex@"+KaTeXVersion+"/fonts/"+font+".woff2")
+	}
+	return paths
+}
+
+// IsFile reports whether path is one of Files
+func IsFile(path string) bool {
+	for _, p := range Files() {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Read returns the contents of a library file. ok is false if path isn't a
+// library file, this build doesn't bundle it, or it doesn't match its pinned
+// checksum.
+func Read(path string) (data []byte, ok bool) {
+	if !IsFile(path) {
+		return nil, false
+	}
+	data, err := files.ReadFile("files/" + path)
+	if err != nil || Verify(path, data) != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Verify checks data against the SHA-256 checksum pinned for a library file
+func Verify(path string, data []byte) error {
+	want, ok := sums[path]
+	if !ok {
+		return fmt.Errorf("%s has no pinned checksum", path)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("%s has SHA-256 %s, want %s", path, got, want)
+	}
+	return nil
+}
+
+// Pinned reports whether a checksum is pinned for path, so Fetch can verify it
+func Pinned(path string) bool {
+	_, ok := sums[path]
+	return ok
+}
+
+// Fetch downloads a library file from CDNURL and verifies it against its
+// pinned checksum
+func Fetch(path string) ([]byte, error) {
+	if !IsFile(path) {
+		return nil, fmt.Errorf("%s is not a library file", path)
+	}
+	data, err := Download(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(path, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Download downloads a library file from CDNURL without verifying it; use
+// Fetch unless the checksum is being recorded
+func Download(path string) ([]byte, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(CDNURL(path))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", CDNURL(path), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// CDNURL returns the URL a library file is published at: "name@version/file"
+// maps to the package's dist directory on jsDelivr
+func CDNURL(path string) string {
+	pkg, file, _ := strings.Cut(path, "/")
+	return "https://cdn.jsdelivr.net/npm/" + pkg + "/dist/" + file
+}
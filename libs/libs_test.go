@@ -0,0 +1,89 @@
+package libs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCDNURL(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{MermaidJS, "https://cdn.jsdelivr.net/npm/mermaid@" + MermaidVersion + "/dist/mermaid.min.js"},
+		{KaTeXCSS, "https://cdn.jsdelivr.net/npm/katex@" + KaTeXVersion + "/dist/katex.min.css"},
+		{"katex@" + KaTeXVersion + "/fonts/KaTeX_Main-Regular.woff2", "https://cdn.jsdelivr.net/npm/katex@" + KaTeXVersion + "/dist/fonts/KaTeX_Main-Regular.woff2"},
+	}
+	for _, tt := range tests {
+		if got := CDNURL(tt.path); got != tt.want {
+			t.Errorf("CDNURL(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	for _, path := range []string{MermaidJS, KaTeXJS, KaTeXCSS} {
+		if !IsFile(path) {
+			t.Errorf("IsFile(%q) = false, want true", path)
+		}
+	}
+	for _, path := range Files() {
+		if !strings.Contains(path, "@") || strings.HasPrefix(path, "/") {
+			t.Errorf("Library path %q should be relative and include a version", path)
+		}
+	}
+
+	// Only library files can be read, not anything else in the embedded directory
+	for _, path := range []string{"README.md", "../libs.go", "mermaid@1.0.0/mermaid.min.js"} {
+		if IsFile(path) {
+			t.Errorf("IsFile(%q) = true, want false", path)
+		}
+		if _, ok := Read(path); ok {
+			t.Errorf("Read(%q) succeeded, want not found", path)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	sum := sha256.Sum256([]byte("library"))
+	sums["test@1.0.0/test.js"] = hex.EncodeToString(sum[:])
+	defer delete(sums, "test@1.0.0/test.js")
+
+	if err := Verify("test@1.0.0/test.js", []byte("library")); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if err := Verify("test@1.0.0/test.js", []byte("tampered")); err == nil {
+		t.Error("Verify() should reject a file that doesn't match its checksum")
+	}
+	if err := Verify("test@1.0.0/other.js", []byte("library")); err == nil {
+		t.Error("Verify() should reject a file without a pinned checksum")
+	}
+}
+
+func TestLibrariesBundled(t *testing.T) {
+	// Pages are meant to work offline, so releases must embed the libraries
+	for _, path := range Files() {
+		if _, ok := Read(path); !ok {
+			t.Errorf("%s is not bundled; run go run fetch.go -update in libs/ and commit files/ and sums.go", path)
+		}
+	}
+}
+
+func TestBundledFilesMatchSums(t *testing.T) {
+	for _, path := range Files() {
+		data, err := files.ReadFile("files/" + path)
+		if err != nil {
+			continue // Not bundled in this build
+		}
+		if err := Verify(path, data); err != nil {
+			t.Errorf("Bundled file: %v", err)
+		}
+	}
+	for path := range sums {
+		if !IsFile(path) {
+			t.Errorf("Checksum pinned for %s, which isn't a library file; run go run fetch.go -update", path)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -10,10 +13,17 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 
+	"mdserver/certs"
+	"mdserver/config"
 	"mdserver/renderer"
 	"mdserver/server"
+
+	"github.com/mdp/qrterminal/v3"
 )
 
 var (
@@ -22,21 +32,56 @@ var (
 	date    = "unknown"
 )
 
+// stringList is a flag that collects every value it is given
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func main() {
 	var (
 		host        = flag.String("host", "localhost", "Host to bind to")
 		port        = flag.Int("port", 0, "Port to bind to (0 for auto-selection)")
-		file        = flag.String("file", "", "Specific markdown file to serve (optional)")
+		file        = flag.String("file", "", "Markdown file to open at / (optional)")
 		dir         = flag.String("dir", ".", "Directory to serve")
+		noFallback  = flag.Bool("no-fallback", false, "Show directory listings instead of README.md or index.md")
+		noMath      = flag.Bool("no-math", false, "Don't render $math$ and fenced math blocks with KaTeX")
+		noWikiLinks = flag.Bool("no-wiki-links", false, "Don't turn [[Page]] into links")
+		noTOC       = flag.Bool("no-toc", false, "Don't show a table of contents or replace [TOC] markers")
 		livereload  = flag.Bool("live-reload", true, "Enable live reload")
+		reloadMode  = flag.String("reload-mode", server.ReloadModePatch, "How pages update on live reload: patch (in place, keeping scroll position) or full")
 		verbose     = flag.Bool("verbose", false, "Enable verbose watcher and live reload diagnostics")
 		showVersion = flag.Bool("version", false, "Show version information")
 		render      = flag.Bool("render", false, "Render markdown to HTML and output to stdout")
+		inline      = flag.Bool("inline-assets", false, "With --render, embed the client libraries in the output so it works offline")
+		exportDir   = flag.String("export", "", "Export the directory as a static HTML site to the given directory")
 		noOpen      = flag.Bool("no-open", false, "Don't open browser on startup")
+		templateDir = flag.String("template-dir", "", "Directory of template files that override the built-in ones")
+		theme       = flag.String("theme", renderer.DefaultTheme, "Page theme: auto (follow the system), light or dark")
+		codeTheme   = flag.String("code-theme", renderer.DefaultCodeTheme, "Syntax highlighting theme for code blocks")
+		darkCode    = flag.String("dark-code-theme", renderer.DefaultDarkCodeTheme, "Syntax highlighting theme for code blocks on dark pages")
+		configFile  = flag.String("config", "", "Config file to use instead of .mdserver.yaml in the served directory")
+		tlsCert     = flag.String("tls-cert", "", "TLS certificate file; serves HTTPS together with --tls-key")
+		tlsKey      = flag.String("tls-key", "", "TLS private key file for --tls-cert")
+		tlsAuto     = flag.Bool("tls-auto", false, "Serve HTTPS with a certificate from a local CA, generated and cached in the user config directory")
+		authMode    = flag.String("auth", "auto", "Access token requirement: auto (when --host isn't a loopback address and there's no --htpasswd), token or none")
+		htpasswd    = flag.String("htpasswd", "", "htpasswd file (bcrypt or SHA1 hashes) of users allowed in with HTTP basic auth")
+		symlinks    = flag.Bool("follow-symlinks", true, "Serve files through symbolic links that stay inside the served directory")
+		public      = flag.Bool("public", false, "Allow --host to be a non-loopback address, serving to other machines")
+		format      = flag.String("format", "text", "Report format for mdserver check: text or json")
 	)
+	var ignore, allowHosts, deny, allowExts stringList
+	flag.Var(&ignore, "ignore", "Gitignore pattern for files to hide from listings, search, export and the watcher (repeatable)")
+	flag.Var(&deny, "deny", "Gitignore pattern for files never to serve, added to the defaults .*, *.pem and *.key (repeatable)")
+	flag.Var(&allowExts, "allow-ext", "Only serve markdown and files with this extension (repeatable)")
+	flag.Var(&allowHosts, "allow-host", "Extra host name the settings forms and live reload accept, e.g. behind a reverse proxy (repeatable)")
 	flag.BoolVar(render, "r", false, "Render markdown to HTML and output to stdout (shorthand)")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: mdserver [flags] [file]\n\nFlags:\n")
+		fmt.Fprintf(os.Stderr, "Usage: mdserver [flags] [file]\n       mdserver check [flags]\n       mdserver config print [flags]\n\nFlags:\n")
 		flag.VisitAll(func(f *flag.Flag) {
 			prefix := "--"
 			if len(f.Name) == 1 {
@@ -49,7 +94,23 @@ func main() {
 			fmt.Fprintf(os.Stderr, "  %s%s\t%s%s\n", prefix, f.Name, f.Usage, defVal)
 		})
 	}
-	flag.Parse()
+
+	// "mdserver config print [flags]" shows the merged settings instead of
+	// serving, and "mdserver check [flags]" reports broken links
+	args := os.Args[1:]
+	printConfig, checkLinks := false, false
+	if len(args) > 0 && args[0] == "check" {
+		checkLinks = true
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "config" {
+		if len(args) < 2 || args[1] != "print" {
+			fmt.Fprintln(os.Stderr, "Usage: mdserver config print [flags]")
+			os.Exit(2)
+		}
+		printConfig = true
+		args = args[2:]
+	}
+	flag.CommandLine.Parse(args)
 
 	// Handle version flag
 	if *showVersion {
@@ -59,6 +120,38 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Fill in settings not given as flags from the project and user config files
+	files, err := loadConfigFiles(*dir, *configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	sources, err := config.Apply(flag.CommandLine, files, configOptions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if printConfig {
+		printSettings(os.Stdout, files, sources)
+		os.Exit(0)
+	}
+
+	if !renderer.IsTheme(*theme) {
+		fmt.Fprintf(os.Stderr, "Error: unknown theme %q (available: %s)\n", *theme, strings.Join(renderer.Themes(), ", "))
+		os.Exit(1)
+	}
+	for _, name := range []string{*codeTheme, *darkCode} {
+		if !renderer.IsCodeTheme(name) {
+			fmt.Fprintf(os.Stderr, "Error: unknown code theme %q (available: %s)\n", name, strings.Join(renderer.CodeThemes(), ", "))
+			os.Exit(1)
+		}
+	}
+
+	if *reloadMode != server.ReloadModePatch && *reloadMode != server.ReloadModeFull {
+		fmt.Fprintf(os.Stderr, "Error: unknown reload mode %q (available: %s, %s)\n", *reloadMode, server.ReloadModePatch, server.ReloadModeFull)
+		os.Exit(1)
+	}
+
 	// Handle render mode
 	if *render {
 		// Get input file from --file flag or positional arg
@@ -77,7 +170,17 @@ func main() {
 			os.Exit(1)
 		}
 
-		html, err := renderer.RenderStandalone(content, inputFile)
+		html, err := renderer.RenderStandalone(content, inputFile, renderer.StandaloneOptions{
+			Theme:         *theme,
+			CodeTheme:     *codeTheme,
+			DarkCodeTheme: *darkCode,
+			InlineAssets:  *inline,
+			Options: renderer.Options{
+				DisableMath:      *noMath,
+				DisableWikiLinks: *noWikiLinks,
+				DisableTOC:       *noTOC,
+			},
+		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error rendering: %v\n", err)
 			os.Exit(1)
@@ -87,6 +190,27 @@ func main() {
 		os.Exit(0)
 	}
 
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(os.Stderr, "Error: --tls-cert and --tls-key must be given together")
+		os.Exit(1)
+	}
+	if *tlsAuto && *tlsCert != "" {
+		fmt.Fprintln(os.Stderr, "Error: --tls-auto can't be combined with --tls-cert and --tls-key")
+		os.Exit(1)
+	}
+	if !*public && !isLoopbackHost(*host) {
+		fmt.Fprintf(os.Stderr, "Error: refusing to bind to %q, which other machines can reach; pass --public to allow it\n", *host)
+		os.Exit(1)
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown report format %q (available: text, json)\n", *format)
+		os.Exit(1)
+	}
+	if *authMode != "auto" && *authMode != "token" && *authMode != "none" {
+		fmt.Fprintf(os.Stderr, "Error: unknown auth mode %q (available: auto, token, none)\n", *authMode)
+		os.Exit(1)
+	}
+
 	// Remove timestamp prefix from log messages
 	log.SetFlags(0)
 
@@ -101,6 +225,66 @@ func main() {
 		log.Fatalf("Directory does not exist: %s", rootDir)
 	}
 
+	// Validate template override directory
+	if *templateDir != "" {
+		if info, err := os.Stat(*templateDir); err != nil || !info.IsDir() {
+			log.Fatalf("Template directory does not exist: %s", *templateDir)
+		}
+	}
+
+	// Resolve entry file: relative paths are looked up in the served
+	// directory first, then relative to the current working directory
+	entryFile := ""
+	if *file != "" {
+		entryFile, err = resolveEntryFile(rootDir, *file)
+		if err != nil {
+			log.Fatalf("Invalid entry file: %v", err)
+		}
+	}
+
+	// Settings for rendering the site outside of the server
+	siteConfig := server.Config{
+		RootDir:          rootDir,
+		DisableFallback:  *noFallback,
+		Theme:            *theme,
+		CodeTheme:        *codeTheme,
+		DarkCodeTheme:    *darkCode,
+		DisableMath:      *noMath,
+		DisableWikiLinks: *noWikiLinks,
+		DisableTOC:       *noTOC,
+		TemplateDir:      *templateDir,
+		IgnorePatterns:   ignore,
+		FollowSymlinks:   *symlinks,
+		DenyPatterns:     deny,
+		AllowExtensions:  allowExts,
+	}
+
+	// Handle check mode
+	if checkLinks {
+		report, err := server.NewServer(siteConfig).Check()
+		if err != nil {
+			log.Fatalf("Check failed: %v", err)
+		}
+		if err := printCheckReport(os.Stdout, report, *format); err != nil {
+			log.Fatalf("Check failed: %v", err)
+		}
+		if len(report.Problems) > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Handle export mode
+	if *exportDir != "" {
+		srv := server.NewServer(siteConfig)
+		stats, err := srv.Export(*exportDir)
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		log.Printf("Exported %d pages, %d directories and %d assets to %s", stats.Pages, stats.Directories, stats.Assets, *exportDir)
+		os.Exit(0)
+	}
+
 	// Find available port if needed
 	actualPort := *port
 	if actualPort == 0 {
@@ -110,37 +294,87 @@ func main() {
 		}
 	}
 
+	// Use the given certificate, or generate one
+	certFile, keyFile := *tlsCert, *tlsKey
+	if *tlsAuto {
+		paths, err := autoCertificate(*host)
+		if err != nil {
+			log.Fatalf("Failed to create TLS certificate: %v", err)
+		}
+		certFile, keyFile = paths.Cert, paths.Key
+		log.Printf("TLS certificate: %s", paths.Cert)
+		log.Printf("To avoid browser warnings on other devices, install the CA certificate %s there", paths.CA)
+	}
+
+	// Require credentials from other machines
+	var users server.Htpasswd
+	if *htpasswd != "" {
+		users, err = server.LoadHtpasswd(*htpasswd)
+		if err != nil {
+			log.Fatalf("Failed to load htpasswd file: %v", err)
+		}
+	}
+	authToken := ""
+	if *authMode == "token" || (*authMode == "auto" && users == nil && !isLoopbackHost(*host)) {
+		authToken, err = server.NewAuthToken()
+		if err != nil {
+			log.Fatalf("Failed to create access token: %v", err)
+		}
+	}
+
 	// Create server configuration
 	config := server.Config{
 		Host:             *host,
 		Port:             actualPort,
 		RootDir:          rootDir,
-		File:             *file,
+		File:             entryFile,
+		DisableFallback:  *noFallback,
 		EnableLiveReload: *livereload,
+		ReloadMode:       *reloadMode,
 		Verbose:          *verbose,
+		Theme:            *theme,
+		CodeTheme:        *codeTheme,
+		DarkCodeTheme:    *darkCode,
+		DisableMath:      *noMath,
+		DisableWikiLinks: *noWikiLinks,
+		DisableTOC:       *noTOC,
+		TemplateDir:      *templateDir,
+		IgnorePatterns:   ignore,
+		TLSCert:          certFile,
+		TLSKey:           keyFile,
+		AuthToken:        authToken,
+		Users:            users,
+		AllowedHosts:     allowHosts,
+		FollowSymlinks:   *symlinks,
+		DenyPatterns:     deny,
+		AllowExtensions:  allowExts,
 	}
 
 	// Initialize and start server
 	srv := server.NewServer(config)
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		log.Println("\nShutting down server...")
-		srv.Stop()
-		os.Exit(0)
-	}()
+	// Shut down gracefully on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Print startup message
-	url := fmt.Sprintf("http://%s:%d", *host, actualPort)
+	scheme := "http"
+	if certFile != "" {
+		scheme = "https"
+	}
+	suffix := ""
+	if authToken != "" {
+		suffix = "/?token=" + authToken
+	}
+	url := fmt.Sprintf("%s://%s:%d", scheme, *host, actualPort) + suffix
 	log.Printf("Serving %s", rootDir)
 	if *file != "" {
 		log.Printf("Entry file: %s", *file)
 	}
 	log.Printf("Server running at %s", url)
+	if *public {
+		printNetworkURLs(scheme, *host, actualPort, suffix)
+	}
 	log.Println("Press Ctrl+C to stop")
 
 	if !*noOpen {
@@ -148,9 +382,221 @@ func main() {
 	}
 
 	// Start server
-	if err := srv.Start(); err != nil {
+	if err := srv.Start(ctx); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
+	log.Println("Server stopped")
+}
+
+// configOptions describes how config file values map onto flags
+var configOptions = config.Options{
+	// Flags that select what mdserver does, or where the project file is
+	Exclude: map[string]bool{
+		"config":  true,
+		"dir":     true,
+		"export":  true,
+		"format":  true,
+		"r":       true,
+		"render":  true,
+		"version": true,
+		// Serving to other machines has to be asked for on the command line,
+		// not by a config file that came with the docs
+		"public": true,
+	},
+	// Settings that could weaken access control or expose more files. A
+	// project file comes with the docs being served, so only the user's own
+	// config file and flags may set them.
+	UserOnly: map[string]bool{
+		"allow-host":      true,
+		"auth":            true,
+		"deny":            true,
+		"follow-symlinks": true,
+		"htpasswd":        true,
+	},
+	Paths: map[string]bool{
+		"htpasswd":     true,
+		"template-dir": true,
+		"tls-cert":     true,
+		"tls-key":      true,
+	},
+}
+
+// printCheckReport writes the result of mdserver check as text or JSON
+func printCheckReport(w io.Writer, report server.CheckReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	for _, p := range report.Problems {
+		fmt.Fprintf(w, "%s: broken link %q: %s\n", p.File, p.Link, p.Reason)
+	}
+	fmt.Fprintf(w, "Checked %d links in %d files, %d broken\n", report.Links, report.Files, len(report.Problems))
+	return nil
+}
+
+// isLoopbackHost reports whether host only accepts connections from this machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// autoCertificate returns the certificate for --tls-auto from the user config
+// directory, creating or renewing it as needed
+func autoCertificate(host string) (certs.Paths, error) {
+	dir, err := config.UserDir()
+	if err != nil {
+		return certs.Paths{}, err
+	}
+	return certs.Ensure(filepath.Join(dir, "certs"), certHosts(host))
+}
+
+// certHosts returns the names a certificate needs for the --host value: the
+// host itself, or this machine's name and addresses when binding to all
+// interfaces
+func certHosts(host string) []string {
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return []string{host}
+	}
+	var hosts []string
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	return append(hosts, interfaceAddresses()...)
+}
+
+// interfaceAddresses returns the addresses of this machine's network
+// interfaces other than loopback and link-local ones, IPv4 first
+func interfaceAddresses() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ipv4, ipv6 []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			ipv4 = append(ipv4, ipNet.IP.String())
+		} else {
+			ipv6 = append(ipv6, ipNet.IP.String())
+		}
+	}
+	return append(ipv4, ipv6...)
+}
+
+// printNetworkURLs prints a URL for each address other machines can use to
+// reach the server, and a QR code of the first one for opening it on a phone
+func printNetworkURLs(scheme, host string, port int, suffix string) {
+	if isLoopbackHost(host) {
+		return
+	}
+	hosts := []string{host}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		hosts = interfaceAddresses()
+	}
+	if len(hosts) == 0 {
+		log.Println("No network addresses found")
+		return
+	}
+
+	var urls []string
+	for _, h := range hosts {
+		urls = append(urls, scheme+"://"+net.JoinHostPort(h, strconv.Itoa(port))+suffix)
+	}
+	log.Println("On your network:")
+	for _, u := range urls {
+		log.Printf("  %s", u)
+	}
+	qrterminal.GenerateHalfBlock(urls[0], qrterminal.L, os.Stderr)
+}
+
+// loadConfigFiles loads the config files in order of precedence: the --config
+// file (or .mdserver.yaml in the served directory), then the user config file.
+// Files that don't exist are nil.
+func loadConfigFiles(dir, configPath string) ([]*config.File, error) {
+	projectPath := configPath
+	if projectPath == "" {
+		projectPath = config.ProjectPath(dir)
+	}
+	project, err := config.Load(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil && configPath != "" {
+		return nil, fmt.Errorf("config file not found: %s", configPath)
+	}
+	if project != nil {
+		project.Project = true
+	}
+
+	var user *config.File
+	if userPath, err := config.UserPath(); err == nil {
+		if user, err = config.Load(userPath); err != nil {
+			return nil, err
+		}
+	}
+	return []*config.File{project, user}, nil
+}
+
+// printSettings writes the config files in use and every setting's effective
+// value along with where it came from
+func printSettings(w io.Writer, files []*config.File, sources map[string]string) {
+	fmt.Fprintln(w, "Config files:")
+	loaded := false
+	for _, file := range files {
+		if file != nil {
+			fmt.Fprintf(w, "  %s\n", file.Path)
+			loaded = true
+		}
+	}
+	if !loaded {
+		fmt.Fprintln(w, "  (none)")
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	flag.VisitAll(func(f *flag.Flag) {
+		if configOptions.Exclude[f.Name] {
+			return
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Name, f.Value.String(), sources[f.Name])
+	})
+	tw.Flush()
+}
+
+// resolveEntryFile returns the absolute path of the entry file, which must be a
+// file inside rootDir
+func resolveEntryFile(rootDir, file string) (string, error) {
+	path := file
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootDir, file)
+		if _, err := os.Stat(path); err != nil {
+			if path, err = filepath.Abs(file); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", file)
+	}
+
+	rel, err := filepath.Rel(rootDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", file, rootDir)
+	}
+	return path, nil
 }
 
 // openBrowser opens the given URL in the default browser.
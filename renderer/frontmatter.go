@@ -0,0 +1,87 @@
+package renderer
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatterFormat describes a front matter block delimiter and its decoder
+type frontMatterFormat struct {
+	delimiter string
+	closers   []string
+	decode    func(data []byte, v *map[string]any) error
+}
+
+var frontMatterFormats = []frontMatterFormat{
+	{
+		// YAML, as used by Jekyll and Hugo; "..." is also a valid YAML document end
+		delimiter: "---",
+		closers:   []string{"---", "..."},
+		decode: func(data []byte, v *map[string]any) error {
+			return yaml.Unmarshal(data, v)
+		},
+	},
+	{
+		// TOML, as used by Hugo and Zola
+		delimiter: "+++",
+		closers:   []string{"+++"},
+		decode: func(data []byte, v *map[string]any) error {
+			return toml.Unmarshal(data, v)
+		},
+	},
+}
+
+// ParseFrontMatter splits a leading YAML (---) or TOML (+++) front matter block
+// from markdown. It returns the decoded metadata and the remaining body. If the
+// document has no front matter, or the block doesn't decode to a mapping, meta
+// is nil and body is the original markdown.
+func ParseFrontMatter(markdown []byte) (meta map[string]any, body []byte) {
+	src := bytes.TrimPrefix(markdown, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+
+	firstLine, rest, ok := cutLine(src)
+	if !ok {
+		return nil, markdown
+	}
+
+	for _, format := range frontMatterFormats {
+		if string(bytes.TrimRight(firstLine, " \t\r")) != format.delimiter {
+			continue
+		}
+
+		// Find the closing delimiter line
+		offset := 0
+		for offset < len(rest) {
+			line, next, _ := cutLine(rest[offset:])
+			trimmed := string(bytes.TrimRight(line, " \t\r"))
+			for _, closer := range format.closers {
+				if trimmed != closer {
+					continue
+				}
+				if err := format.decode(rest[:offset], &meta); err != nil {
+					return nil, markdown
+				}
+				if meta == nil {
+					meta = map[string]any{}
+				}
+				return meta, next
+			}
+			offset = len(rest) - len(next)
+		}
+		return nil, markdown
+	}
+
+	return nil, markdown
+}
+
+// cutLine splits src after the first newline. ok is false if src is empty.
+func cutLine(src []byte) (line, rest []byte, ok bool) {
+	if len(src) == 0 {
+		return nil, nil, false
+	}
+	if i := bytes.IndexByte(src, '\n'); i >= 0 {
+		return src[:i], src[i+1:], true
+	}
+	return src, nil, true
+}
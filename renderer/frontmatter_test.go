@@ -0,0 +1,119 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		wantMeta map[string]any
+		wantBody string
+	}{
+		{
+			name:     "yaml",
+			markdown: "---\ntitle: Design Doc\ntags: [a, b]\n---\n# Heading\n",
+			wantMeta: map[string]any{"title": "Design Doc", "tags": []any{"a", "b"}},
+			wantBody: "# Heading\n",
+		},
+		{
+			name:     "yaml with document end marker",
+			markdown: "---\nauthor: sam\n...\nBody\n",
+			wantMeta: map[string]any{"author": "sam"},
+			wantBody: "Body\n",
+		},
+		{
+			name:     "toml",
+			markdown: "+++\ntitle = \"Spec\"\ndraft = true\n+++\nBody\n",
+			wantMeta: map[string]any{"title": "Spec", "draft": true},
+			wantBody: "Body\n",
+		},
+		{
+			name:     "empty block",
+			markdown: "---\n---\nBody\n",
+			wantMeta: map[string]any{},
+			wantBody: "Body\n",
+		},
+		{
+			name:     "no front matter",
+			markdown: "# Title\n\n---\n\ntext\n",
+			wantMeta: nil,
+			wantBody: "# Title\n\n---\n\ntext\n",
+		},
+		{
+			name:     "unclosed block",
+			markdown: "---\ntitle: x\n",
+			wantMeta: nil,
+			wantBody: "---\ntitle: x\n",
+		},
+		{
+			name:     "not a mapping",
+			markdown: "---\nJust a heading\n---\n",
+			wantMeta: nil,
+			wantBody: "---\nJust a heading\n---\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, body := ParseFrontMatter([]byte(tt.markdown))
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if (meta == nil) != (tt.wantMeta == nil) {
+				t.Fatalf("meta = %#v, want %#v", meta, tt.wantMeta)
+			}
+			for key, want := range tt.wantMeta {
+				if got := meta[key]; !equalValue(got, want) {
+					t.Errorf("meta[%q] = %#v, want %#v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderWithFrontMatter(t *testing.T) {
+	doc, err := Render([]byte("---\ntitle: From Meta\n---\n# From Heading\n\nBody text.\n"))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	if doc.Title != "From Meta" {
+		t.Errorf("Title = %q, want front matter title", doc.Title)
+	}
+	html := string(doc.HTML)
+	if strings.Contains(html, "<hr") || strings.Contains(html, "title:") {
+		t.Errorf("Front matter should be stripped from output, got %q", html)
+	}
+	if !strings.Contains(html, "From Heading") {
+		t.Errorf("Expected body to be rendered, got %q", html)
+	}
+
+	doc, err = Render([]byte("# Only Heading\n"))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if doc.Title != "Only Heading" {
+		t.Errorf("Title = %q, want heading title", doc.Title)
+	}
+}
+
+// equalValue compares decoded front matter values, including slices
+func equalValue(got, want any) bool {
+	gotSlice, ok1 := got.([]any)
+	wantSlice, ok2 := want.([]any)
+	if ok1 && ok2 {
+		if len(gotSlice) != len(wantSlice) {
+			return false
+		}
+		for i := range gotSlice {
+			if gotSlice[i] != wantSlice[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return got == want
+}
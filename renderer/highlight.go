@@ -0,0 +1,84 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/util"
+)
+
+// DefaultCodeTheme is the chroma style used for code highlighting when none is configured
+const DefaultCodeTheme = "github"
+
+// newHighlighting returns the goldmark extension that highlights fenced code blocks.
+// Highlighted tokens are emitted as CSS classes so the theme can be changed without
+// re-rendering; the matching stylesheet comes from HighlightCSS.
+func newHighlighting() goldmark.Extender {
+	return highlighting.NewHighlighting(
+		highlighting.WithFormatOptions(
+			html.WithClasses(true),
+			html.PreventSurroundingPre(true),
+		),
+		highlighting.WithWrapperRenderer(renderCodeBlockWrapper),
+	)
+}
+
+// renderCodeBlockWrapper writes the <pre><code> wrapper around a code block.
+// The language-* class is kept so that mermaid blocks (which have no lexer and
+// are therefore left unhighlighted) can still be picked up by processMermaidBlocks.
+func renderCodeBlockWrapper(w util.BufWriter, ctx highlighting.CodeBlockContext, entering bool) {
+	if !entering {
+		w.WriteString("</code></pre>\n")
+		return
+	}
+
+	if ctx.Highlighted() {
+		w.WriteString(`<pre class="chroma">`)
+	} else {
+		w.WriteString("<pre>")
+	}
+	w.WriteString("<code")
+	if lang, ok := ctx.Language(); ok {
+		w.WriteString(` class="language-`)
+		w.Write(util.EscapeHTML(lang))
+		w.WriteString(`"`)
+	}
+	w.WriteString(">")
+}
+
+// IsCodeTheme reports whether name is a known code highlighting theme
+func IsCodeTheme(name string) bool {
+	_, ok := styles.Registry[name]
+	return ok
+}
+
+// CodeThemes returns the sorted names of all available code highlighting themes
+func CodeThemes() []string {
+	names := styles.Names()
+	sort.Strings(names)
+	return names
+}
+
+// HighlightCSS returns the stylesheet for highlighted code blocks using the given theme.
+// An empty theme selects DefaultCodeTheme.
+func HighlightCSS(theme string) (string, error) {
+	if theme == "" {
+		theme = DefaultCodeTheme
+	}
+	style, ok := styles.Registry[theme]
+	if !ok {
+		return "", fmt.Errorf("unknown code theme: %s", theme)
+	}
+
+	var buf bytes.Buffer
+	formatter := html.New(html.WithClasses(true))
+	if err := formatter.WriteCSS(&buf, style); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,99 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownWithHighlighting(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		check    func(t *testing.T, html string)
+	}{
+		{
+			name:     "known language is highlighted",
+			markdown: "```go\npackage main\n```",
+			check: func(t *testing.T, html string) {
+				if !strings.Contains(html, `<pre class="chroma"><code class="language-go">`) {
+					t.Errorf("Expected highlighted wrapper, got %q", html)
+				}
+				if !strings.Contains(html, `<span class="kn">package</span>`) {
+					t.Errorf("Expected keyword token span, got %q", html)
+				}
+			},
+		},
+		{
+			name:     "unknown language is left plain",
+			markdown: "```notalanguage\n<b>x</b>\n```",
+			check: func(t *testing.T, html string) {
+				if !strings.Contains(html, `<pre><code class="language-notalanguage">`) {
+					t.Errorf("Expected plain wrapper, got %q", html)
+				}
+				if !strings.Contains(html, "&lt;b&gt;x&lt;/b&gt;") {
+					t.Errorf("Expected escaped content, got %q", html)
+				}
+			},
+		},
+		{
+			name:     "no language is left plain",
+			markdown: "```\nplain text\n```",
+			check: func(t *testing.T, html string) {
+				if !strings.Contains(html, "<pre><code>plain text") {
+					t.Errorf("Expected plain code block, got %q", html)
+				}
+			},
+		},
+		{
+			name:     "mermaid is not highlighted",
+			markdown: "```mermaid\ngraph TD\n    A --> B\n```",
+			check: func(t *testing.T, html string) {
+				if !strings.Contains(html, `<div class="mermaid">`) {
+					t.Errorf("Expected mermaid div, got %q", html)
+				}
+				if strings.Contains(html, "chroma") {
+					t.Errorf("Mermaid block should not be highlighted, got %q", html)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderMarkdown([]byte(tt.markdown))
+			if err != nil {
+				t.Fatalf("RenderMarkdown() error = %v", err)
+			}
+			tt.check(t, string(result))
+		})
+	}
+}
+
+func TestHighlightCSS(t *testing.T) {
+	css, err := HighlightCSS("")
+	if err != nil {
+		t.Fatalf("HighlightCSS() error = %v", err)
+	}
+	if !strings.Contains(css, ".chroma") || !strings.Contains(css, ".kn") {
+		t.Errorf("Expected chroma class rules, got %q", css)
+	}
+
+	if _, err := HighlightCSS("no-such-theme"); err == nil {
+		t.Error("Expected error for unknown theme")
+	}
+}
+
+func TestRenderStandaloneIncludesHighlightCSS(t *testing.T) {
+	html, err := RenderStandalone([]byte("# Title\n\n```go\nx := 1\n```\n"), "doc.md", StandaloneOptions{CodeTheme: "monokai"})
+	if err != nil {
+		t.Fatalf("RenderStandalone() error = %v", err)
+	}
+
+	want, _ := HighlightCSS("monokai")
+	if !strings.Contains(string(html), want) {
+		t.Error("Standalone output should embed the selected theme's CSS")
+	}
+	if !strings.Contains(string(html), `<pre class="chroma">`) {
+		t.Error("Standalone output should contain highlighted code")
+	}
+}
@@ -0,0 +1,92 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+
+	"mdserver/libs"
+)
+
+// katexFontPattern matches the woff2 font references in katex.min.css
+var katexFontPattern = regexp.MustCompile(`url\((fonts/[^)]+\.woff2)\)`)
+
+// writeInlineLibraries writes the client libraries a rendered document needs
+// as inline <script> and <style> elements. Documents without diagrams or math
+// get neither.
+func writeInlineLibraries(buf *bytes.Buffer, htmlContent []byte) error {
+	if bytes.Contains(htmlContent, []byte(`<div class="mermaid">`)) {
+		js, err := readLibrary(libs.MermaidJS)
+		if err != nil {
+			return err
+		}
+		writeInlineScript(buf, js)
+	}
+
+	if bytes.Contains(htmlContent, []byte(`class="math `)) {
+		css, err := readLibrary(libs.KaTeXCSS)
+		if err != nil {
+			return err
+		}
+		css, err = inlineKaTeXFonts(css)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("\t<style>\n")
+		buf.Write(css)
+		buf.WriteString("\n\t</style>\n")
+
+		js, err := readLibrary(libs.KaTeXJS)
+		if err != nil {
+			return err
+		}
+		writeInlineScript(buf, js)
+	}
+	return nil
+}
+
+// readLibrary returns a bundled library file. Builds without the files
+// download it from the CDN, checked against its pinned checksum.
+func readLibrary(path string) ([]byte, error) {
+	if data, ok := libs.Read(path); ok {
+		return data, nil
+	}
+	if !libs.Pinned(path) {
+		return nil, fmt.Errorf("%s is not bundled in this build and has no pinned checksum (run go generate ./libs)", path)
+	}
+	data, err := libs.Fetch(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not bundled in this build (run go generate ./libs) and couldn't be downloaded: %w", path, err)
+	}
+	return data, nil
+}
+
+// scriptEndPattern matches text that would end a <script> element, which
+// HTML recognizes in any letter case
+var scriptEndPattern = regexp.MustCompile(`(?i)</(script)`)
+
+// writeInlineScript writes js in a <script> element, escaping anything that
+// would end the element early
+func writeInlineScript(buf *bytes.Buffer, js []byte) {
+	buf.WriteString("\t<script>\n")
+	buf.Write(scriptEndPattern.ReplaceAll(js, []byte(`<\/$1`)))
+	buf.WriteString("\n\t</script>\n")
+}
+
+// inlineKaTeXFonts replaces the woff2 font URLs in KaTeX's stylesheet with
+// data URIs. The woff and ttf fallbacks are left as they are; browsers that
+// can run KaTeX use the woff2 fonts.
+func inlineKaTeXFonts(css []byte) ([]byte, error) {
+	var missing error
+	css = katexFontPattern.ReplaceAllFunc(css, func(match []byte) []byte {
+		path := "katex@" + libs.KaTeXVersion + "/" + string(katexFontPattern.FindSubmatch(match)[1])
+		font, err := readLibrary(path)
+		if err != nil {
+			missing = err
+			return match
+		}
+		return []byte("url(data:font/woff2;base64," + base64.StdEncoding.EncodeToString(font) + ")")
+	})
+	return css, missing
+}
@@ -0,0 +1,66 @@
+package renderer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mdserver/libs"
+)
+
+func TestRenderStandaloneInlineAssets(t *testing.T) {
+	// Documents without diagrams or math don't need any library
+	html, err := RenderStandalone([]byte("# Plain\n"), "plain.md", StandaloneOptions{InlineAssets: true})
+	if err != nil {
+		t.Fatalf("RenderStandalone() error = %v", err)
+	}
+	if strings.Contains(string(html), "<script src=") || strings.Contains(string(html), "cdn.jsdelivr.net") {
+		t.Errorf("Expected no external scripts, got %s", html)
+	}
+
+	input := []byte("```mermaid\ngraph TD\n  A-->B\n```\n\nMath: $x^2$\n")
+	html, err = RenderStandalone(input, "doc.md", StandaloneOptions{InlineAssets: true})
+	if _, bundled := libs.Read(libs.MermaidJS); !bundled {
+		if err == nil || !strings.Contains(err.Error(), "go generate") {
+			t.Errorf("Expected an error about missing libraries, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("RenderStandalone() error = %v", err)
+	}
+	for _, external := range []string{"<script src=", "<link rel=\"stylesheet\"", "url(fonts/KaTeX_Main-Regular.woff2)"} {
+		if strings.Contains(string(html), external) {
+			t.Errorf("Expected self-contained output, found %q", external)
+		}
+	}
+	if !strings.Contains(string(html), "data:font/woff2;base64,") {
+		t.Error("Expected KaTeX fonts as data URIs")
+	}
+}
+
+func TestRenderStandaloneCDNAssets(t *testing.T) {
+	html, err := RenderStandalone([]byte("# Doc\n"), "doc.md", StandaloneOptions{})
+	if err != nil {
+		t.Fatalf("RenderStandalone() error = %v", err)
+	}
+	for _, path := range []string{libs.MermaidJS, libs.KaTeXCSS, libs.KaTeXJS} {
+		if !strings.Contains(string(html), libs.CDNURL(path)) {
+			t.Errorf("Expected pinned CDN URL %s", libs.CDNURL(path))
+		}
+	}
+}
+
+func TestWriteInlineScript(t *testing.T) {
+	var buf bytes.Buffer
+	writeInlineScript(&buf, []byte(`var s = "</script>", t = "</SCRIPT >", u = "</Script";`))
+	got := buf.String()
+	if strings.Count(strings.ToLower(got), "</script") != 1 {
+		t.Errorf("writeInlineScript() = %q, want only the closing tag unescaped", got)
+	}
+	for _, want := range []string{`"<\/script>"`, `"<\/SCRIPT >"`, `"<\/Script"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("writeInlineScript() = %q, want %s", got, want)
+		}
+	}
+}
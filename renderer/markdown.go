@@ -3,6 +3,7 @@ package renderer
 import (
 	"bytes"
 	_ "embed"
+	"fmt"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -11,6 +12,9 @@ import (
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+
+	"mdserver/libs"
 )
 
 //go:embed standalone.css
@@ -18,12 +22,34 @@ var standaloneCSS string
 
 var mdRenderer goldmark.Markdown
 
+// markdownVariants holds a goldmark instance for each combination of the
+// extensions that Options can turn off, keyed by [math, wiki links]
+var markdownVariants = map[[2]bool]goldmark.Markdown{}
+
 func init() {
-	// Initialize goldmark with GitHub Flavored Markdown extensions
-	mdRenderer = goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM, // GitHub Flavored Markdown (tables, strikethrough, task lists, autolinks)
-		),
+	for _, math := range []bool{true, false} {
+		for _, wikiLinks := range []bool{true, false} {
+			markdownVariants[[2]bool{math, wikiLinks}] = newMarkdown(math, wikiLinks)
+		}
+	}
+	mdRenderer = markdownVariants[[2]bool{true, true}]
+}
+
+// newMarkdown creates a goldmark instance with GitHub Flavored Markdown,
+// highlighting and the optional extensions that are enabled
+func newMarkdown(math, wikiLinks bool) goldmark.Markdown {
+	extensions := []goldmark.Extender{
+		extension.GFM, // GitHub Flavored Markdown (tables, strikethrough, task lists, autolinks)
+		newHighlighting(),
+	}
+	if math {
+		extensions = append(extensions, mathExtension{})
+	}
+	if wikiLinks {
+		extensions = append(extensions, wikiLinkExtension{})
+	}
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
@@ -34,16 +60,81 @@ func init() {
 	)
 }
 
-// RenderMarkdown converts markdown content to HTML
-func RenderMarkdown(markdown []byte) ([]byte, error) {
+// Document is a rendered markdown document
+type Document struct {
+	HTML  []byte
+	Meta  map[string]any // Front matter, nil if the document has none
+	Title string         // Front matter title or first H1, empty if neither
+	TOC   []*TOCEntry    // Headings, nested by level
+}
+
+// Options configures RenderWithOptions
+type Options struct {
+	// WikiResolver resolves the pages of [[wiki links]]; without one, links
+	// to other pages are rendered as missing
+	WikiResolver WikiResolver
+	// DisableMath leaves $...$ and fenced math as plain text and code
+	DisableMath bool
+	// DisableWikiLinks leaves [[wiki links]] as text
+	DisableWikiLinks bool
+	// DisableTOC leaves out the table of contents, and [TOC] markers as text
+	DisableTOC bool
+}
+
+// Render parses front matter and converts the remaining markdown to HTML
+func Render(markdown []byte) (*Document, error) {
+	return RenderWithOptions(markdown, Options{})
+}
+
+// RenderWithOptions is Render with options
+func RenderWithOptions(markdown []byte, opts Options) (*Document, error) {
+	meta, body := ParseFrontMatter(markdown)
+
+	pc := parser.NewContext()
+	if opts.WikiResolver != nil {
+		pc.Set(wikiResolverKey, opts.WikiResolver)
+	}
+	md := markdownVariants[[2]bool{!opts.DisableMath, !opts.DisableWikiLinks}]
+	root := md.Parser().Parse(text.NewReader(body), parser.WithContext(pc))
+	var toc []*TOCEntry
+	if !opts.DisableTOC {
+		toc = buildTOC(root, body)
+	}
+
 	var buf bytes.Buffer
-	if err := mdRenderer.Convert(markdown, &buf); err != nil {
+	if err := md.Renderer().Render(&buf, body, root); err != nil {
 		return nil, err
 	}
 	htmlContent := buf.Bytes()
 	// Post-process to convert mermaid code blocks to div.mermaid elements
 	htmlContent = processMermaidBlocks(htmlContent)
-	return htmlContent, nil
+	if !opts.DisableMath {
+		htmlContent = processMathBlocks(htmlContent)
+	}
+	if !opts.DisableTOC {
+		htmlContent = replaceTOCMarkers(htmlContent, toc)
+	}
+
+	title, _ := meta["title"].(string)
+	if title == "" {
+		title = headingTitle(body)
+	}
+
+	return &Document{
+		HTML:  htmlContent,
+		Meta:  meta,
+		Title: title,
+		TOC:   toc,
+	}, nil
+}
+
+// RenderMarkdown converts markdown content to HTML, stripping any front matter
+func RenderMarkdown(markdown []byte) ([]byte, error) {
+	doc, err := Render(markdown)
+	if err != nil {
+		return nil, err
+	}
+	return doc.HTML, nil
 }
 
 // processMermaidBlocks converts mermaid code blocks to div.mermaid elements for Mermaid.js rendering
@@ -84,21 +175,53 @@ func NewRenderer() goldmark.Markdown {
 	return mdRenderer
 }
 
+// StandaloneOptions configures RenderStandalone
+type StandaloneOptions struct {
+	// Theme is the page theme (see Themes); empty selects DefaultTheme
+	Theme string
+	// CodeTheme is the code highlighting theme; empty selects DefaultCodeTheme
+	CodeTheme string
+	// DarkCodeTheme is the code highlighting theme for dark pages; empty selects DefaultDarkCodeTheme
+	DarkCodeTheme string
+	// InlineAssets embeds the client libraries the document needs instead of
+	// loading them from the CDN, so the output works offline
+	InlineAssets bool
+	// Options turns off renderer extensions
+	Options
+}
+
 // RenderStandalone converts markdown to a complete standalone HTML document
-func RenderStandalone(markdown []byte, filename string) ([]byte, error) {
+func RenderStandalone(markdown []byte, filename string, opts StandaloneOptions) ([]byte, error) {
 	// Render markdown content
-	content, err := RenderMarkdown(markdown)
+	doc, err := RenderWithOptions(markdown, opts.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	theme := opts.Theme
+	if theme == "" {
+		theme = DefaultTheme
+	}
+	if !IsTheme(theme) {
+		return nil, fmt.Errorf("unknown theme: %s", theme)
+	}
+	highlightCSS, err := ThemedHighlightCSS(opts.CodeTheme, opts.DarkCodeTheme)
 	if err != nil {
 		return nil, err
 	}
 
-	// Extract title from first H1 or use filename
-	title := extractTitle(markdown, filename)
+	// Use front matter title or first H1, falling back to the filename
+	title := doc.Title
+	if title == "" {
+		title = filenameTitle(filename)
+	}
 
 	// Build standalone HTML document
 	var buf bytes.Buffer
 	buf.WriteString(`<!DOCTYPE html>
-<html lang="en">
+<html lang="en" data-theme="`)
+	buf.WriteString(theme)
+	buf.WriteString(`">
 <head>
 	<meta charset="UTF-8">
 	<meta name="viewport" content="width=device-width, initial-scale=1.0">
@@ -108,17 +231,72 @@ func RenderStandalone(markdown []byte, filename string) ([]byte, error) {
 	<style>
 `)
 	buf.WriteString(standaloneCSS)
+	buf.WriteString(highlightCSS)
 	buf.WriteString(`	</style>
-	<script src="https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.min.js"></script>
-</head>
-<body>
+`)
+	if opts.InlineAssets {
+		if err := writeInlineLibraries(&buf, doc.HTML); err != nil {
+			return nil, err
+		}
+	} else {
+		fmt.Fprintf(&buf, `	<script src="%s"></script>
+	<link rel="stylesheet" href="%s">
+	<script src="%s"></script>
+`, libs.CDNURL(libs.MermaidJS), libs.CDNURL(libs.KaTeXCSS), libs.CDNURL(libs.KaTeXJS))
+	}
+	buf.WriteString(`</head>
+`)
+	if len(doc.TOC) > 0 {
+		// Outline in a sticky sidebar, as in the server's page template
+		buf.WriteString(`<body class="has-toc">
 	<div class="container">
+		<div class="page-body">
+		<aside class="toc-sidebar"><nav class="toc">`)
+		buf.Write(TOCHTML(doc.TOC))
+		buf.WriteString(`</nav></aside>
+		<div class="content">
 		`)
-	buf.Write(content)
+		buf.Write(doc.HTML)
+		buf.WriteString(`
+		</div>
+		</div>
+	</div>`)
+	} else {
+		buf.WriteString(`<body>
+	<div class="container">
+		`)
+		buf.Write(doc.HTML)
+		buf.WriteString(`
+	</div>`)
+	}
 	buf.WriteString(`
-	</div>
 	<script>
-		mermaid.initialize({ startOnLoad: true, theme: 'default' });
+		(function() {
+			var theme = document.documentElement.dataset.theme;
+			var prefersDark = window.matchMedia('(prefers-color-scheme: dark)');
+			var dark = theme === 'dark' || (theme !== 'light' && prefersDark.matches);
+			if (window.mermaid) {
+				mermaid.initialize({ startOnLoad: true, theme: dark ? 'dark' : 'default' });
+			}
+			// Typeset math
+			window.renderMath = function(root) {
+				if (!window.katex) {
+					return;
+				}
+				root.querySelectorAll('.math').forEach(function(el) {
+					katex.render(el.textContent, el, { displayMode: el.classList.contains('math-display'), throwOnError: false });
+				});
+			};
+			renderMath(document.body);
+			// Diagrams are drawn once, so redraw them when the system theme changes
+			if (theme !== 'light' && theme !== 'dark') {
+				prefersDark.addEventListener('change', function() {
+					if (document.querySelector('.mermaid')) {
+						window.location.reload();
+					}
+				});
+			}
+		})();
 	</script>
 </body>
 </html>
@@ -127,9 +305,18 @@ func RenderStandalone(markdown []byte, filename string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// extractTitle extracts the title from the first H1 heading or uses the filename
-func extractTitle(markdown []byte, filename string) string {
-	// Look for first H1 heading (# Title)
+// Title returns the title Render would give a document, its front matter
+// title or first H1, without rendering it. It is "" if there is neither.
+func Title(markdown []byte) string {
+	meta, body := ParseFrontMatter(markdown)
+	if title, _ := meta["title"].(string); title != "" {
+		return title
+	}
+	return headingTitle(body)
+}
+
+// headingTitle returns the text of the first H1 heading, or "" if there is none
+func headingTitle(markdown []byte) string {
 	lines := strings.Split(string(markdown), "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -137,8 +324,11 @@ func extractTitle(markdown []byte, filename string) string {
 			return strings.TrimPrefix(line, "# ")
 		}
 	}
+	return ""
+}
 
-	// Fall back to filename without extension
+// filenameTitle returns the filename without directory or extension
+func filenameTitle(filename string) string {
 	base := filepath.Base(filename)
 	ext := filepath.Ext(base)
 	if ext != "" {
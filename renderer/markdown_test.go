@@ -261,3 +261,36 @@ func extractMermaidDivs(html string) []string {
 	}
 	return divs
 }
+
+func TestRenderDisabledExtensions(t *testing.T) {
+	input := []byte("[TOC]\n\n# Title\n\nSee [[guide]] and $x^2$.\n\n```math\ny\n```\n")
+
+	doc, err := RenderWithOptions(input, Options{})
+	if err != nil {
+		t.Fatalf("RenderWithOptions() error = %v", err)
+	}
+	for _, want := range []string{`class="toc toc-inline"`, `class="wikilink`, `class="math math-inline"`, `class="math math-display"`} {
+		if !strings.Contains(string(doc.HTML), want) {
+			t.Errorf("Expected %s with all extensions, got %s", want, doc.HTML)
+		}
+	}
+
+	doc, err = RenderWithOptions(input, Options{DisableMath: true, DisableWikiLinks: true, DisableTOC: true})
+	if err != nil {
+		t.Fatalf("RenderWithOptions() error = %v", err)
+	}
+	html := string(doc.HTML)
+	for _, unwanted := range []string{"toc-inline", "wikilink", `class="math`} {
+		if strings.Contains(html, unwanted) {
+			t.Errorf("Expected no %s with extensions disabled, got %s", unwanted, html)
+		}
+	}
+	for _, want := range []string{"<p>[TOC]</p>", "[[guide]]", "$x^2$", `<pre`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected %s to be left as written, got %s", want, html)
+		}
+	}
+	if doc.TOC != nil {
+		t.Errorf("Expected no TOC entries, got %v", doc.TOC)
+	}
+}
@@ -0,0 +1,246 @@
+package renderer
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Node kinds for math. Math is rendered as elements with the "math" class
+// holding the escaped TeX source, plus "math-inline" or "math-display" for
+// the display mode; pages typeset them with KaTeX.
+var (
+	kindMath      = ast.NewNodeKind("Math")
+	kindMathBlock = ast.NewNodeKind("MathBlock")
+)
+
+// mathNode is a $...$ (or $$...$$ inside a paragraph) span. Its children are raw
+// text segments of the TeX source.
+type mathNode struct {
+	ast.BaseInline
+	display bool // Written as $$...$$
+}
+
+func (n *mathNode) Kind() ast.NodeKind { return kindMath }
+
+func (n *mathNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Display": strconv.FormatBool(n.display)}, nil)
+}
+
+// mathBlockNode is a $$ ... $$ block starting on its own line. Its lines are the TeX source.
+type mathBlockNode struct {
+	ast.BaseBlock
+	closed bool // The closing $$ has been read
+}
+
+func (n *mathBlockNode) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlockNode) IsRaw() bool { return true }
+
+func (n *mathBlockNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathExtension keeps $...$ and $$...$$ math out of emphasis and escape
+// processing. Fenced math blocks are handled by processMathBlocks.
+type mathExtension struct{}
+
+func (mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 690)),
+		parser.WithInlineParsers(util.Prioritized(mathParser{}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(mathRenderer{}, 500)))
+}
+
+// mathParser parses inline math. Like pandoc, a single $ only opens math when
+// followed by a non-space and only closes it when preceded by a non-space and
+// not followed by a digit, so prices like "$5 and $10" stay text.
+type mathParser struct{}
+
+func (mathParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (mathParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+	if len(line) <= delim || line[delim] == ' ' || line[delim] == '\t' || line[delim] == '\n' || line[delim] == '$' {
+		return nil
+	}
+
+	l, pos := block.Position()
+	block.Advance(delim)
+	node := &mathNode{display: delim == 2}
+	for {
+		line, segment := block.PeekLine()
+		if line == nil {
+			block.SetPosition(l, pos)
+			return nil
+		}
+		for i := 0; i < len(line); i++ {
+			switch {
+			case line[i] == '\\':
+				i++ // Skip escaped characters, including \$
+			case line[i] == '$' && closesMath(line, i, delim):
+				if i > 0 {
+					node.AppendChild(node, ast.NewRawTextSegment(segment.WithStop(segment.Start+i)))
+				}
+				block.Advance(i + delim)
+				return node
+			}
+		}
+		if util.IsBlank(line) {
+			// Math doesn't span paragraphs
+			block.SetPosition(l, pos)
+			return nil
+		}
+		node.AppendChild(node, ast.NewRawTextSegment(segment))
+		block.AdvanceLine()
+	}
+}
+
+// closesMath reports whether the $ at line[i] closes math opened with delim dollar signs
+func closesMath(line []byte, i, delim int) bool {
+	if delim == 2 {
+		return i+1 < len(line) && line[i+1] == '$'
+	}
+	if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' || line[i-1] == '\n' {
+		return false
+	}
+	return i+1 >= len(line) || line[i+1] < '0' || line[i+1] > '9'
+}
+
+// mathBlockParser parses display math that starts with $$ on its own line and
+// ends with $$ at the end of a line, possibly the same one
+type mathBlockParser struct{}
+
+func (mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	start := pos + 2
+	rest := util.TrimRightSpace(line[start:])
+	node := &mathBlockNode{}
+	if end := bytes.Index(rest, []byte("$$")); end >= 0 {
+		if end != len(rest)-2 {
+			return nil, parser.NoChildren // $$...$$ followed by text is inline math
+		}
+		node.closed = true
+		rest = rest[:end]
+	}
+	if !util.IsBlank(rest) {
+		node.Lines().Append(text.NewSegment(segment.Start+start, segment.Start+start+len(rest)))
+	}
+	advanceLine(reader, line, segment)
+	return node, parser.NoChildren
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	block := node.(*mathBlockNode)
+	if block.closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	if line == nil {
+		return parser.Close
+	}
+	rest := util.TrimRightSpace(line)
+	if bytes.HasSuffix(rest, []byte("$$")) {
+		rest = rest[:len(rest)-2]
+		if !util.IsBlank(rest) {
+			node.Lines().Append(text.NewSegment(segment.Start, segment.Start+len(rest)))
+		}
+		block.closed = true
+		advanceLine(reader, line, segment)
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	advanceLine(reader, line, segment)
+	return parser.Continue | parser.NoChildren
+}
+
+// advanceLine moves the reader to the end of the current line, leaving the
+// newline for the block parser
+func advanceLine(reader text.Reader, line []byte, segment text.Segment) {
+	length := segment.Len()
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		length--
+	}
+	reader.Advance(length)
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+// mathRenderer writes math nodes as elements holding their escaped TeX source
+type mathRenderer struct{}
+
+func (r mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, r.renderMath)
+	reg.Register(kindMathBlock, r.renderMathBlock)
+}
+
+func (mathRenderer) renderMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	if node.(*mathNode).display {
+		w.WriteString(`<span class="math math-display">`)
+	} else {
+		w.WriteString(`<span class="math math-inline">`)
+	}
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		w.Write(util.EscapeHTML(c.(*ast.Text).Segment.Value(source)))
+	}
+	w.WriteString("</span>")
+	return ast.WalkSkipChildren, nil
+}
+
+func (mathRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	w.WriteString(`<div class="math math-display">`)
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		w.Write(util.EscapeHTML(segment.Value(source)))
+	}
+	w.WriteString("</div>\n")
+	return ast.WalkContinue, nil
+}
+
+// mathBlockPattern matches fenced code blocks with the math language
+var mathBlockPattern = regexp.MustCompile(`(?i)<pre><code\s+class=["']language-math["']>([\s\S]*?)</code></pre>`)
+
+// processMathBlocks converts ```math code blocks to display math, like $$ blocks
+func processMathBlocks(htmlContent []byte) []byte {
+	return mathBlockPattern.ReplaceAllFunc(htmlContent, func(match []byte) []byte {
+		source := bytes.TrimSpace(mathBlockPattern.FindSubmatch(match)[1])
+		var result bytes.Buffer
+		result.WriteString(`<div class="math math-display">`)
+		result.Write(source)
+		result.WriteString(`</div>`)
+		return result.Bytes()
+	})
+}
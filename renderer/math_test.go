@@ -0,0 +1,99 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMath(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "inline math is kept out of emphasis",
+			input:    "Let $x_1 * y_2 = z_3$ hold.",
+			expected: `<p>Let <span class="math math-inline">x_1 * y_2 = z_3</span> hold.</p>`,
+		},
+		{
+			name:     "inline math is escaped",
+			input:    "If $a<b$ then.",
+			expected: `<p>If <span class="math math-inline">a&lt;b</span> then.</p>`,
+		},
+		{
+			name:     "backslashes are kept",
+			input:    `Area $\pi r^2$.`,
+			expected: `<p>Area <span class="math math-inline">\pi r^2</span>.</p>`,
+		},
+		{
+			name:     "prices are not math",
+			input:    "It costs $5 and $10.",
+			expected: `<p>It costs $5 and $10.</p>`,
+		},
+		{
+			name:     "space after the opening dollar",
+			input:    "A $ x$ sign.",
+			expected: `<p>A $ x$ sign.</p>`,
+		},
+		{
+			name:     "escaped dollar",
+			input:    `Not \$math$.`,
+			expected: `<p>Not $math$.</p>`,
+		},
+		{
+			name:     "display math inside a paragraph",
+			input:    "So $$e^{i\\pi}$$ holds.",
+			expected: `<p>So <span class="math math-display">e^{i\pi}</span> holds.</p>`,
+		},
+		{
+			name:     "display math block",
+			input:    "$$\n\\sum_{i=1}^n i_k\n$$\n",
+			expected: `<div class="math math-display">\sum_{i=1}^n i_k` + "\n</div>",
+		},
+		{
+			name:     "single line display math block",
+			input:    "$$a_1 + a_2$$\n",
+			expected: `<div class="math math-display">a_1 + a_2</div>`,
+		},
+		{
+			name:     "display math block at the end of the file",
+			input:    "Text\n$$\nx\n$$",
+			expected: "<p>Text</p>\n" + `<div class="math math-display">x` + "\n</div>",
+		},
+		{
+			name:     "fenced math block",
+			input:    "```math\na < b_1\n```\n",
+			expected: `<div class="math math-display">a &lt; b_1</div>`,
+		},
+		{
+			name:     "math in code is left alone",
+			input:    "`$x$`",
+			expected: `<p><code>$x$</code></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := RenderMarkdown([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("RenderMarkdown() error = %v", err)
+			}
+			if got := strings.TrimSpace(string(html)); got != tt.expected {
+				t.Errorf("RenderMarkdown(%q) =\n%s\nwant\n%s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderStandaloneMath(t *testing.T) {
+	html, err := RenderStandalone([]byte("Euler: $e^{i\\pi} + 1 = 0$\n"), "math.md", StandaloneOptions{})
+	if err != nil {
+		t.Fatalf("RenderStandalone() error = %v", err)
+	}
+	for _, want := range []string{"katex.min.css", "katex.min.js", "renderMath(document.body)", `<span class="math math-inline">`} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("Expected standalone output to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package renderer
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Section is the plain text of a document under a single heading
+type Section struct {
+	Heading string // Heading text, empty for content before the first heading
+	ID      string // Heading anchor as generated by the renderer
+	Level   int    // Heading level (1-6), 0 for content before the first heading
+	Text    string // Plain text of the section body
+}
+
+// ExtractSections splits markdown into sections at each heading. Front matter
+// is stripped first, and heading IDs match those in the rendered HTML.
+func ExtractSections(markdown []byte) []Section {
+	_, body := ParseFrontMatter(markdown)
+	doc := mdRenderer.Parser().Parse(text.NewReader(body))
+
+	sections := []Section{{}}
+	var buf bytes.Buffer
+	flush := func() {
+		sections[len(sections)-1].Text = strings.TrimSpace(buf.String())
+		buf.Reset()
+	}
+
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		if heading, ok := child.(*ast.Heading); ok {
+			flush()
+			section := Section{
+				Heading: nodeText(heading, body),
+				Level:   heading.Level,
+			}
+			if id, ok := heading.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					section.ID = string(b)
+				}
+			}
+			sections = append(sections, section)
+			continue
+		}
+		writeNodeText(&buf, child, body)
+		buf.WriteByte('\n')
+	}
+	flush()
+
+	// Drop the leading section if the document starts with a heading
+	if sections[0].Text == "" && len(sections) > 1 {
+		sections = sections[1:]
+	}
+	return sections
+}
+
+// nodeText returns the plain text content of a node
+func nodeText(n ast.Node, source []byte) string {
+	var buf bytes.Buffer
+	writeNodeText(&buf, n, source)
+	return strings.TrimSpace(buf.String())
+}
+
+// writeNodeText writes the plain text content of n and its descendants to buf
+func writeNodeText(buf *bytes.Buffer, n ast.Node, source []byte) {
+	ast.Walk(n, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if node.Type() == ast.TypeBlock {
+				buf.WriteByte('\n')
+			}
+			return ast.WalkContinue, nil
+		}
+		switch node := node.(type) {
+		case *ast.Text:
+			buf.Write(node.Segment.Value(source))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(node.Value)
+		case *wikiLinkNode:
+			buf.WriteString(node.label)
+		case *ast.FencedCodeBlock, *ast.CodeBlock, *ast.HTMLBlock:
+			lines := node.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				line := lines.At(i)
+				buf.Write(line.Value(source))
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,46 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractSections(t *testing.T) {
+	markdown := "---\ntitle: Meta\n---\n" +
+		"Intro paragraph.\n\n" +
+		"# Getting Started\n\n" +
+		"Install with **go install**.\n\n" +
+		"```sh\nmake build\n```\n\n" +
+		"## Configuration Options\n\n" +
+		"- first item\n- second item\n"
+
+	sections := ExtractSections([]byte(markdown))
+	if len(sections) != 3 {
+		t.Fatalf("Expected 3 sections, got %d: %+v", len(sections), sections)
+	}
+
+	if sections[0].Heading != "" || sections[0].Text != "Intro paragraph." {
+		t.Errorf("Unexpected leading section: %+v", sections[0])
+	}
+
+	if sections[1].Heading != "Getting Started" || sections[1].ID != "getting-started" || sections[1].Level != 1 {
+		t.Errorf("Unexpected heading section: %+v", sections[1])
+	}
+	if !strings.Contains(sections[1].Text, "Install with go install.") || !strings.Contains(sections[1].Text, "make build") {
+		t.Errorf("Section text should include paragraph and code, got %q", sections[1].Text)
+	}
+
+	if sections[2].ID != "configuration-options" || sections[2].Level != 2 {
+		t.Errorf("Unexpected subsection: %+v", sections[2])
+	}
+	if !strings.Contains(sections[2].Text, "first item") || !strings.Contains(sections[2].Text, "second item") {
+		t.Errorf("Section text should include list items, got %q", sections[2].Text)
+	}
+}
+
+func TestExtractSectionsStartingWithHeading(t *testing.T) {
+	sections := ExtractSections([]byte("# Title\n\nBody.\n"))
+	if len(sections) != 1 || sections[0].Heading != "Title" || sections[0].Text != "Body." {
+		t.Errorf("Unexpected sections: %+v", sections)
+	}
+}
@@ -0,0 +1,86 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Page themes. Pages carry the theme in a data-theme attribute on <html>;
+// the stylesheets switch colors, and pages switch the mermaid theme, on it.
+const (
+	ThemeAuto  = "auto" // Follow the system light/dark preference
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+
+	DefaultTheme = ThemeAuto
+)
+
+// DefaultDarkCodeTheme is the chroma style used for code blocks on dark pages
+const DefaultDarkCodeTheme = "github-dark"
+
+// Themes returns the names of the built-in page themes
+func Themes() []string {
+	return []string{ThemeAuto, ThemeLight, ThemeDark}
+}
+
+// IsTheme reports whether name is a built-in page theme
+func IsTheme(name string) bool {
+	for _, theme := range Themes() {
+		if name == theme {
+			return true
+		}
+	}
+	return false
+}
+
+// Selectors for pages that are dark: explicitly, or in auto mode (or without a
+// data-theme attribute at all) when the system prefers a dark color scheme
+const (
+	darkSelector     = `:root[data-theme="dark"]`
+	autoDarkSelector = `:root:not([data-theme="light"])`
+	darkMediaQuery   = `@media (prefers-color-scheme: dark)`
+)
+
+// ThemedHighlightCSS returns the stylesheet for highlighted code blocks that
+// follows the page theme: lightTheme normally, and darkTheme on dark pages.
+// Empty names select DefaultCodeTheme and DefaultDarkCodeTheme.
+func ThemedHighlightCSS(lightTheme, darkTheme string) (string, error) {
+	if darkTheme == "" {
+		darkTheme = DefaultDarkCodeTheme
+	}
+	light, err := HighlightCSS(lightTheme)
+	if err != nil {
+		return "", err
+	}
+	dark, err := HighlightCSS(darkTheme)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(light)
+	b.WriteString(scopeCSS(dark, darkSelector))
+	fmt.Fprintf(&b, "%s {\n%s}\n", darkMediaQuery, scopeCSS(dark, autoDarkSelector))
+	return b.String(), nil
+}
+
+// scopeCSS prefixes the selector of each rule in chroma's stylesheet output,
+// which has one "/* Name */ selector { ... }" rule per line
+func scopeCSS(css, scope string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(css, "\n") {
+		if line == "" {
+			continue
+		}
+		comment, rule := "", line
+		if i := strings.Index(line, "*/ "); strings.HasPrefix(line, "/*") && i >= 0 {
+			comment, rule = line[:i+3], line[i+3:]
+		}
+		b.WriteString(comment)
+		b.WriteString(scope)
+		b.WriteString(" ")
+		b.WriteString(rule)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThemedHighlightCSS(t *testing.T) {
+	css, err := ThemedHighlightCSS("", "")
+	if err != nil {
+		t.Fatalf("ThemedHighlightCSS() error = %v", err)
+	}
+
+	light, _ := HighlightCSS(DefaultCodeTheme)
+	if !strings.HasPrefix(css, light) {
+		t.Error("Light code theme should apply unscoped")
+	}
+	if !strings.Contains(css, `/* PreWrapper */ :root[data-theme="dark"] .chroma {`) {
+		t.Errorf("Dark code theme should apply to dark pages, got %q", css)
+	}
+	if !strings.Contains(css, "@media (prefers-color-scheme: dark) {\n/* Background */ :root:not([data-theme=\"light\"]) .bg {") {
+		t.Errorf("Dark code theme should apply to auto pages when the system is dark, got %q", css)
+	}
+
+	if _, err := ThemedHighlightCSS("github", "no-such-theme"); err == nil {
+		t.Error("Expected error for unknown dark code theme")
+	}
+}
+
+func TestRenderStandaloneTheme(t *testing.T) {
+	for _, theme := range Themes() {
+		html, err := RenderStandalone([]byte("# Title\n"), "doc.md", StandaloneOptions{Theme: theme})
+		if err != nil {
+			t.Fatalf("RenderStandalone(%s) error = %v", theme, err)
+		}
+		if !strings.Contains(string(html), `<html lang="en" data-theme="`+theme+`">`) {
+			t.Errorf("Expected data-theme=%q on <html>", theme)
+		}
+	}
+
+	if _, err := RenderStandalone([]byte("# Title\n"), "doc.md", StandaloneOptions{Theme: "sepia"}); err == nil {
+		t.Error("Expected error for unknown theme")
+	}
+}
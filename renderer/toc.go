@@ -0,0 +1,95 @@
+package renderer
+
+import (
+	"bytes"
+	"html"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// tocMarker is the rendered form of a paragraph containing only [TOC]
+var tocMarker = []byte("<p>[TOC]</p>")
+
+// TOCEntry is a heading in a document's table of contents
+type TOCEntry struct {
+	Title    string
+	ID       string // Heading anchor as generated by the renderer
+	Level    int
+	Children []*TOCEntry // Headings nested under this one
+}
+
+// buildTOC collects the headings of a parsed document into a tree. A heading
+// becomes a child of the closest preceding heading with a lower level.
+func buildTOC(doc ast.Node, source []byte) []*TOCEntry {
+	var toc []*TOCEntry
+	var stack []*TOCEntry
+
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		heading, ok := child.(*ast.Heading)
+		if !ok {
+			continue
+		}
+		id, ok := heading.AttributeString("id")
+		if !ok {
+			continue
+		}
+		idBytes, ok := id.([]byte)
+		if !ok {
+			continue
+		}
+		entry := &TOCEntry{
+			Title: nodeText(heading, source),
+			ID:    string(idBytes),
+			Level: heading.Level,
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].Level >= entry.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc = append(toc, entry)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+		stack = append(stack, entry)
+	}
+	return toc
+}
+
+// TOCHTML renders a table of contents as nested lists of heading links, the
+// same markup the toc template in page.html produces
+func TOCHTML(toc []*TOCEntry) []byte {
+	var buf bytes.Buffer
+	writeTOCList(&buf, toc)
+	return buf.Bytes()
+}
+
+func writeTOCList(buf *bytes.Buffer, entries []*TOCEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	buf.WriteString("<ul>")
+	for _, entry := range entries {
+		buf.WriteString(`<li><a href="#`)
+		buf.WriteString(html.EscapeString(entry.ID))
+		buf.WriteString(`">`)
+		buf.WriteString(html.EscapeString(entry.Title))
+		buf.WriteString("</a>")
+		writeTOCList(buf, entry.Children)
+		buf.WriteString("</li>")
+	}
+	buf.WriteString("</ul>")
+}
+
+// replaceTOCMarkers replaces [TOC] paragraphs with the table of contents
+func replaceTOCMarkers(htmlContent []byte, toc []*TOCEntry) []byte {
+	if !bytes.Contains(htmlContent, tocMarker) {
+		return htmlContent
+	}
+	var nav bytes.Buffer
+	nav.WriteString(`<nav class="toc toc-inline">`)
+	nav.Write(TOCHTML(toc))
+	nav.WriteString("</nav>")
+	return bytes.ReplaceAll(htmlContent, tocMarker, nav.Bytes())
+}
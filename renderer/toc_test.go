@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTOC(t *testing.T) {
+	doc, err := Render([]byte("# Title\n\n## One\n\n### One A\n\n#### Deep\n\n## Two\n\n### Two A\n\n# Appendix\n"))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	// Flatten the tree as "depth:id" to check the nesting
+	var got []string
+	var walk func(entries []*TOCEntry, depth int)
+	walk = func(entries []*TOCEntry, depth int) {
+		for _, e := range entries {
+			got = append(got, strings.Repeat(">", depth)+e.ID)
+			walk(e.Children, depth+1)
+		}
+	}
+	walk(doc.TOC, 0)
+
+	want := []string{"title", ">one", ">>one-a", ">>>deep", ">two", ">>two-a", "appendix"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("TOC = %v, want %v", got, want)
+	}
+	if doc.TOC[0].Title != "Title" || doc.TOC[0].Level != 1 {
+		t.Errorf("TOC[0] = %+v, want Title at level 1", doc.TOC[0])
+	}
+}
+
+func TestRenderTOCSkippedLevels(t *testing.T) {
+	doc, err := Render([]byte("### Starts deep\n\n## Then shallower\n\n#### Then deeper\n"))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if len(doc.TOC) != 2 || len(doc.TOC[1].Children) != 1 {
+		t.Fatalf("Expected two roots with the last heading nested under the second, got %+v", doc.TOC)
+	}
+}
+
+func TestRenderTOCMarker(t *testing.T) {
+	doc, err := Render([]byte("# Guide\n\n[TOC]\n\n## Install **now**\n\n`[TOC]`\n"))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	html := string(doc.HTML)
+
+	want := `<nav class="toc toc-inline"><ul><li><a href="#guide">Guide</a><ul><li><a href="#install-now">Install now</a></li></ul></li></ul></nav>`
+	if !strings.Contains(html, want) {
+		t.Errorf("Expected [TOC] to be replaced with %s, got %s", want, html)
+	}
+	if !strings.Contains(html, "<code>[TOC]</code>") {
+		t.Errorf("[TOC] in code should be left alone, got %s", html)
+	}
+}
+
+func TestRenderStandaloneTOC(t *testing.T) {
+	html, err := RenderStandalone([]byte("# Doc\n\n## Section\n"), "doc.md", StandaloneOptions{})
+	if err != nil {
+		t.Fatalf("RenderStandalone() error = %v", err)
+	}
+	if !strings.Contains(string(html), `<aside class="toc-sidebar"><nav class="toc"><ul><li><a href="#doc">Doc</a>`) {
+		t.Errorf("Expected TOC sidebar in standalone output, got %s", html)
+	}
+
+	html, err = RenderStandalone([]byte("No headings.\n"), "doc.md", StandaloneOptions{})
+	if err != nil {
+		t.Fatalf("RenderStandalone() error = %v", err)
+	}
+	if strings.Contains(string(html), `class="toc`) {
+		t.Errorf("Expected no TOC without headings, got %s", html)
+	}
+}
@@ -0,0 +1,153 @@
+package renderer
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// WikiResolver returns the URL of the page a wiki link names, such as "Page",
+// "Page.md" or "docs/Page", or false if there is no such page
+type WikiResolver func(page string) (href string, ok bool)
+
+// kindWikiLink is the node kind for [[wiki links]]. Links are rendered as <a
+// class="wikilink">, or as <span class="wikilink wikilink-missing"> when the
+// page doesn't exist.
+var kindWikiLink = ast.NewNodeKind("WikiLink")
+
+// wikiResolverKey holds the WikiResolver in the parser context
+var wikiResolverKey = parser.NewContextKey()
+
+// wikiLinkNode is a resolved [[Page#Heading|label]] link
+type wikiLinkNode struct {
+	ast.BaseInline
+	page  string // Page name as written
+	label string
+	href  string // Empty if the page doesn't exist
+}
+
+func (n *wikiLinkNode) Kind() ast.NodeKind { return kindWikiLink }
+
+func (n *wikiLinkNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Page": n.page, "Href": n.href}, nil)
+}
+
+// wikiLinkExtension adds Obsidian-style [[Page]], [[Page#Heading]] and
+// [[Page|label]] links, resolved with the WikiResolver passed to Render
+type wikiLinkExtension struct{}
+
+func (wikiLinkExtension) Extend(m goldmark.Markdown) {
+	// Before goldmark's link parser (200), which would take the outer brackets
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(wikiLinkParser{}, 199)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(wikiLinkRenderer{}, 500)))
+}
+
+type wikiLinkParser struct{}
+
+func (wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line[2:], []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	inner := string(line[2 : 2+end])
+	if strings.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+
+	target, label, hasLabel := strings.Cut(inner, "|")
+	page, heading, _ := strings.Cut(target, "#")
+	page, heading = strings.TrimSpace(page), strings.TrimSpace(heading)
+	if page == "" && heading == "" {
+		return nil
+	}
+	node := &wikiLinkNode{page: page, label: strings.TrimSpace(label)}
+	if !hasLabel || node.label == "" {
+		switch {
+		case page == "":
+			node.label = heading
+		case heading == "":
+			node.label = page
+		default:
+			node.label = page + " > " + heading
+		}
+	}
+
+	if page == "" {
+		node.href = "#" + HeadingID(heading)
+	} else if resolve, ok := pc.Get(wikiResolverKey).(WikiResolver); ok {
+		if href, ok := resolve(page); ok {
+			node.href = href
+			if heading != "" {
+				node.href += "#" + HeadingID(heading)
+			}
+		}
+	}
+
+	block.Advance(2 + end + 2)
+	return node
+}
+
+// HeadingID returns the id that goldmark's automatic heading IDs give a
+// heading with this text, leaving out the suffix added to repeated headings
+func HeadingID(heading string) string {
+	var id strings.Builder
+	for _, c := range []byte(strings.TrimSpace(heading)) {
+		switch {
+		case c >= 0x80:
+			// goldmark drops non-ASCII characters
+		case util.IsAlphaNumeric(c):
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			id.WriteByte(c)
+		case util.IsSpace(c) || c == '-' || c == '_':
+			id.WriteByte('-')
+		}
+	}
+	if id.Len() == 0 {
+		return "heading"
+	}
+	return id.String()
+}
+
+// wikiLinkRenderer writes wiki links as links, or as marked text when their page doesn't exist
+type wikiLinkRenderer struct{}
+
+func (r wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindWikiLink, r.renderWikiLink)
+}
+
+func (wikiLinkRenderer) renderWikiLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*wikiLinkNode)
+	if n.href == "" {
+		w.WriteString(`<span class="wikilink wikilink-missing" title="No page named `)
+		w.Write(util.EscapeHTML([]byte(n.page)))
+		w.WriteString(`">`)
+		w.Write(util.EscapeHTML([]byte(n.label)))
+		w.WriteString("</span>")
+		return ast.WalkContinue, nil
+	}
+	w.WriteString(`<a class="wikilink" href="`)
+	w.Write(util.EscapeHTML([]byte(n.href)))
+	w.WriteString(`">`)
+	w.Write(util.EscapeHTML([]byte(n.label)))
+	w.WriteString("</a>")
+	return ast.WalkContinue, nil
+}
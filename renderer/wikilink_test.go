@@ -0,0 +1,124 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderWikiLinks(t *testing.T) {
+	pages := map[string]string{
+		"guide":      "/docs/guide.md",
+		"Team Notes": "/Team%20Notes.md",
+	}
+	resolve := func(page string) (string, bool) {
+		href, ok := pages[page]
+		return href, ok
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "page",
+			input:    "See [[guide]].",
+			expected: `<p>See <a class="wikilink" href="/docs/guide.md">guide</a>.</p>`,
+		},
+		{
+			name:     "heading",
+			input:    "See [[guide#Getting Started]].",
+			expected: `<p>See <a class="wikilink" href="/docs/guide.md#getting-started">guide &gt; Getting Started</a>.</p>`,
+		},
+		{
+			name:     "label",
+			input:    "See [[Team Notes|the notes]].",
+			expected: `<p>See <a class="wikilink" href="/Team%20Notes.md">the notes</a>.</p>`,
+		},
+		{
+			name:     "heading and label",
+			input:    "[[guide#Install_it|install]]",
+			expected: `<p><a class="wikilink" href="/docs/guide.md#install-it">install</a></p>`,
+		},
+		{
+			name:     "heading on the same page",
+			input:    "[[#Usage Notes]]",
+			expected: `<p><a class="wikilink" href="#usage-notes">Usage Notes</a></p>`,
+		},
+		{
+			name:     "missing page",
+			input:    "[[Roadmap <2025>|plans]]",
+			expected: `<p><span class="wikilink wikilink-missing" title="No page named Roadmap &lt;2025&gt;">plans</span></p>`,
+		},
+		{
+			name:     "inside emphasis",
+			input:    "*read [[guide]]*",
+			expected: `<p><em>read <a class="wikilink" href="/docs/guide.md">guide</a></em></p>`,
+		},
+		{
+			name:     "regular links still work",
+			input:    "[guide](guide.md) and [[guide]]",
+			expected: `<p><a href="guide.md">guide</a> and <a class="wikilink" href="/docs/guide.md">guide</a></p>`,
+		},
+		{
+			name:     "empty brackets",
+			input:    "[[]] and [[ | ]]",
+			expected: `<p>[[]] and [[ | ]]</p>`,
+		},
+		{
+			name:     "unclosed",
+			input:    "[[guide and more",
+			expected: `<p>[[guide and more</p>`,
+		},
+		{
+			name:     "escaped",
+			input:    `\[[guide]]`,
+			expected: `<p>[[guide]]</p>`,
+		},
+		{
+			name:     "code",
+			input:    "`[[guide]]`",
+			expected: `<p><code>[[guide]]</code></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := RenderWithOptions([]byte(tt.input), Options{WikiResolver: resolve})
+			if err != nil {
+				t.Fatalf("RenderWithOptions() error = %v", err)
+			}
+			if got := strings.TrimSpace(string(doc.HTML)); got != tt.expected {
+				t.Errorf("RenderWithOptions(%q) =\n%s\nwant\n%s", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	// Without a resolver, links to other pages are missing
+	html, err := RenderMarkdown([]byte("[[guide]]"))
+	if err != nil {
+		t.Fatalf("RenderMarkdown() error = %v", err)
+	}
+	if !strings.Contains(string(html), "wikilink-missing") {
+		t.Errorf("Expected a missing link without a resolver, got %s", html)
+	}
+}
+
+func TestHeadingID(t *testing.T) {
+	tests := map[string]string{
+		"Getting Started":    "getting-started",
+		"  API_v2 (beta)!  ": "api-v2-beta",
+		"Café au lait":       "caf-au-lait",
+		"???":                "heading",
+	}
+	for heading, want := range tests {
+		if got := HeadingID(heading); got != want {
+			t.Errorf("HeadingID(%q) = %q, want %q", heading, got, want)
+		}
+		// Must agree with the ids goldmark generates
+		html, _ := RenderMarkdown([]byte("# " + heading))
+		if !strings.Contains(string(html), `id="`+want+`"`) {
+			t.Errorf("goldmark id for %q: %s, want %q", heading, html, want)
+		}
+	}
+}
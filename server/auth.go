@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tokenCookie holds the access token once a browser has presented it in the URL
+const tokenCookie = "mdserver_token"
+
+// Htpasswd maps user names to password hashes, as in an Apache htpasswd file
+type Htpasswd map[string]string
+
+// LoadHtpasswd reads an htpasswd file. Only bcrypt ("htpasswd -B") and SHA1
+// ("htpasswd -s") hashes are supported.
+func LoadHtpasswd(path string) (Htpasswd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := make(Htpasswd)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, lineNum)
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("%s:%d: unsupported password hash for %s (use bcrypt: htpasswd -B)", path, lineNum, user)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%s: no users", path)
+	}
+	return users, nil
+}
+
+// Check reports whether password is correct for user
+func (h Htpasswd) Check(user, password string) bool {
+	hash, ok := h[user]
+	if !ok {
+		return false
+	}
+	if sha, ok := strings.CutPrefix(hash, "{SHA}"); ok {
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(base64.StdEncoding.EncodeToString(sum[:])), []byte(sha)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewAuthToken returns a random access token for Config.AuthToken
+func NewAuthToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// authEnabled reports whether requests need credentials
+func (s *Server) authEnabled() bool {
+	return s.config.AuthToken != "" || len(s.config.Users) > 0
+}
+
+// requireAuth wraps next so that only requests with valid credentials reach
+// it: the access token (in a "token" query parameter, which is exchanged for a
+// cookie, or in the cookie) or a user from the htpasswd file. This covers every
+// route, including the live reload WebSocket.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" && s.validToken(token) {
+			// Keep the token out of the address bar and history from here on
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   s.config.TLSCert != "",
+				SameSite: http.SameSiteLaxMode,
+			})
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				u := *r.URL
+				query := u.Query()
+				query.Del("token")
+				u.RawQuery = query.Encode()
+				http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cookie, err := r.Cookie(tokenCookie); err == nil && s.validToken(cookie.Value) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user, password, ok := r.BasicAuth(); ok && s.config.Users.Check(user, password) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(s.config.Users) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mdserver", charset="UTF-8"`)
+		}
+		http.Error(w, "Unauthorized: open the URL with the access token that mdserver printed at startup", http.StatusUnauthorized)
+	})
+}
+
+func (s *Server) validToken(token string) bool {
+	return s.config.AuthToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AuthToken)) == 1
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoadHtpasswd(t *testing.T) {
+	dir := t.TempDir()
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "users")
+	content := "# comment\nalice:" + string(hash) + "\nbob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := LoadHtpasswd(path)
+	if err != nil {
+		t.Fatalf("LoadHtpasswd() error = %v", err)
+	}
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{"alice", "s3cret", true},
+		{"alice", "wrong", false},
+		{"bob", "password", true},
+		{"bob", "s3cret", false},
+		{"carol", "s3cret", false},
+	}
+	for _, tt := range tests {
+		if got := users.Check(tt.user, tt.password); got != tt.want {
+			t.Errorf("Check(%q, %q) = %t, want %t", tt.user, tt.password, got, tt.want)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"md5":    "dave:$apr1$abc$def\n",
+		"plain":  "erin:password\n",
+		"format": "no-colon\n",
+		"empty":  "# nobody\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadHtpasswd(path); err == nil {
+			t.Errorf("LoadHtpasswd(%s) should fail", name)
+		}
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte("# Doc\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(Config{
+		RootDir:          tmpDir,
+		EnableLiveReload: true,
+		AuthToken:        "tok3n",
+		Users:            Htpasswd{"alice": string(hash)},
+	})
+	defer srv.Shutdown(context.Background())
+	handler := srv.Handler()
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// No credentials
+	rec := serve(httptest.NewRequest(http.MethodGet, "/doc.md", nil))
+	if rec.Code != http.StatusUnauthorized || !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic") {
+		t.Errorf("No credentials: status %d, WWW-Authenticate %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+	if rec := serve(httptest.NewRequest(http.MethodPost, "/settings/shutdown", nil)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Shutdown without credentials: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// The token is exchanged for a cookie and removed from the URL
+	rec = serve(httptest.NewRequest(http.MethodGet, "/doc.md?token=tok3n&x=1", nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/doc.md?x=1" {
+		t.Errorf("Token: status %d to %q, want %d to /doc.md?x=1", rec.Code, rec.Header().Get("Location"), http.StatusSeeOther)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != tokenCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly token cookie, got %v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/doc.md", nil)
+	req.AddCookie(cookies[0])
+	if rec := serve(req); rec.Code != http.StatusOK {
+		t.Errorf("Token cookie: status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	for _, bad := range []string{"/doc.md?token=wrong"} {
+		if rec := serve(httptest.NewRequest(http.MethodGet, bad, nil)); rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s: status %d, want %d", bad, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	req = httptest.NewRequest(http.MethodGet, "/doc.md", nil)
+	req.AddCookie(&http.Cookie{Name: tokenCookie, Value: "wrong"})
+	if rec := serve(req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Wrong cookie: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// Basic auth
+	req = httptest.NewRequest(http.MethodGet, "/doc.md", nil)
+	req.SetBasicAuth("alice", "s3cret")
+	if rec := serve(req); rec.Code != http.StatusOK {
+		t.Errorf("Basic auth: status %d, want %d", rec.Code, http.StatusOK)
+	}
+	req.SetBasicAuth("alice", "wrong")
+	if rec := serve(req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Wrong password: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// The live reload WebSocket is covered too
+	upgrade := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/livereload", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		return req
+	}
+	if rec := serve(upgrade()); rec.Code != http.StatusUnauthorized {
+		t.Errorf("WebSocket without credentials: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	req = upgrade()
+	req.AddCookie(cookies[0])
+	if rec := serve(req); rec.Code == http.StatusUnauthorized {
+		t.Error("WebSocket with the token cookie should reach the live reload handler")
+	}
+}
+
+func TestHandlerWithoutAuth(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte("# Doc\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	NewServer(Config{RootDir: tmpDir}).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc.md", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status %d without auth configured, want %d", rec.Code, http.StatusOK)
+	}
+}
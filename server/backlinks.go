@@ -0,0 +1,308 @@
+package server
+
+import (
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Backlink is a page that links to another, for the "Linked from" panel
+type Backlink struct {
+	Title string
+	Href  string
+}
+
+// PageLinks returns the title of the markdown file at path and the markdown
+// files it links to, or ok false if it can't be read
+type PageLinks func(path string) (title string, targets []string, ok bool)
+
+// LinkGraph records which markdown files under a root directory link to which
+// others, so a page can list the pages linking to it. Like WikiIndex, it is
+// built on the first lookup and then kept current through Update, which only
+// rereads the changed page unless pages were added or ignore rules changed.
+// Building renders every page, so it happens without holding mu and the
+// finished graph is swapped in.
+type LinkGraph struct {
+	rootDir string
+	ignore  *IgnoreMatcher
+	allowed func(path string) bool // Serving policy; other files are left out
+	links   PageLinks
+	buildMu sync.Mutex // Lets only one lookup build the graph at a time
+	mu      sync.RWMutex
+	built   bool
+	changed map[string]bool       // Paths changed during the build in progress, nil if none is
+	pages   map[string]linkedPage // Absolute path -> page
+}
+
+// maxBuildAttempts bounds how often a build starts over because pages changed
+// while it ran. The last attempt is kept, and only the changed pages reread.
+const maxBuildAttempts = 3
+
+// linkedPage is a page in the link graph
+type linkedPage struct {
+	title   string
+	targets map[string]bool // Absolute paths of the pages it links to
+}
+
+// NewLinkGraph creates an empty graph for rootDir that reads pages with links.
+// Files matched by ignore, and files and directories the server wouldn't serve
+// according to allowed, are left out.
+func NewLinkGraph(rootDir string, ignore *IgnoreMatcher, allowed func(path string) bool, links PageLinks) *LinkGraph {
+	return &LinkGraph{
+		rootDir: rootDir,
+		ignore:  ignore,
+		allowed: allowed,
+		links:   links,
+		pages:   make(map[string]linkedPage),
+	}
+}
+
+// ensureBuilt reads every markdown file under the root directory if that
+// hasn't been done yet. Lookups and updates aren't blocked meanwhile; if
+// pages change during the build, it starts over, up to maxBuildAttempts.
+func (g *LinkGraph) ensureBuilt() {
+	g.mu.RLock()
+	built := g.built
+	g.mu.RUnlock()
+	if built {
+		return
+	}
+
+	g.buildMu.Lock()
+	defer g.buildMu.Unlock()
+	for attempt := 1; ; attempt++ {
+		g.mu.Lock()
+		if g.built {
+			g.mu.Unlock()
+			return
+		}
+		g.changed = make(map[string]bool)
+		g.mu.Unlock()
+
+		pages := g.readTree()
+
+		g.mu.Lock()
+		if len(g.changed) == 0 || attempt == maxBuildAttempts {
+			g.pages = pages
+			g.built = true
+			for path := range g.changed {
+				g.refresh(path)
+			}
+			g.changed = nil
+			g.mu.Unlock()
+			return
+		}
+		g.mu.Unlock()
+	}
+}
+
+// readTree reads every markdown file under the root directory
+func (g *LinkGraph) readTree() map[string]linkedPage {
+	pages := make(map[string]linkedPage)
+	walkServedMarkdown(g.rootDir, g.ignore, g.allowed, func(path string) error {
+		if page, ok := g.readPage(path); ok {
+			pages[path] = page
+		}
+		return nil
+	})
+	return pages
+}
+
+// readPage reads the title and links of a markdown file
+func (g *LinkGraph) readPage(path string) (linkedPage, bool) {
+	title, targets, ok := g.links(path)
+	if !ok {
+		return linkedPage{}, false
+	}
+	page := linkedPage{title: title, targets: make(map[string]bool, len(targets))}
+	for _, target := range targets {
+		if target != path {
+			page.targets[target] = true
+		}
+	}
+	return page, true
+}
+
+// refresh updates the graph for a path that changed while it was being built,
+// without starting over: changed pages are reread, removed ones dropped, and
+// new pages read, though links from other pages to them are only picked up
+// when those pages change. Caller must hold the write lock.
+func (g *LinkGraph) refresh(path string) {
+	info, err := os.Stat(path)
+	switch {
+	case isIgnoreFile(filepath.Base(path)):
+		// Drop pages the new rules hide, and read pages they show
+		for page := range g.pages {
+			if g.ignore.Ignored(page, false) {
+				delete(g.pages, page)
+			}
+		}
+		g.readNewPages(filepath.Dir(path))
+	case err != nil:
+		g.removePage(path)
+	case path != g.rootDir && (!g.allowed(path) || g.ignore.Ignored(path, info.IsDir())):
+		g.removePage(path)
+	case info.IsDir():
+		g.readNewPages(path)
+	case isMarkdownFile(path):
+		if page, ok := g.readPage(path); ok {
+			g.pages[path] = page
+		} else {
+			g.removePage(path)
+		}
+	}
+}
+
+// readNewPages reads the markdown files under dir that aren't in the graph.
+// Caller must hold the write lock.
+func (g *LinkGraph) readNewPages(dir string) {
+	walkServedMarkdown(dir, g.ignore, g.allowed, func(path string) error {
+		if _, known := g.pages[path]; !known {
+			if page, ok := g.readPage(path); ok {
+				g.pages[path] = page
+			}
+		}
+		return nil
+	})
+}
+
+// removePage drops path and any pages below it. Caller must hold the write lock.
+func (g *LinkGraph) removePage(path string) {
+	delete(g.pages, path)
+	prefix := path + string(filepath.Separator)
+	for page := range g.pages {
+		if strings.HasPrefix(page, prefix) {
+			delete(g.pages, page)
+		}
+	}
+}
+
+// Update refreshes the graph for a changed path. An edited page only has its
+// own links reread. A new page or directory may be the target of links that
+// didn't resolve before, so it, like a changed ignore file, makes the next
+// lookup rebuild the graph.
+func (g *LinkGraph) Update(path string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	path = filepath.Clean(path)
+	if !g.built {
+		// A build in progress may have read the old version. Files other
+		// than pages, such as logs being written, don't affect it.
+		if g.changed != nil && g.affects(path) {
+			g.changed[path] = true
+		}
+		return
+	}
+
+	if isIgnoreFile(filepath.Base(path)) {
+		g.reset()
+		return
+	}
+	_, known := g.pages[path]
+	info, err := os.Stat(path)
+	switch {
+	case err != nil, !g.allowed(path):
+		g.removePage(path)
+	case known:
+		if page, ok := g.readPage(path); ok {
+			g.pages[path] = page
+		} else {
+			g.removePage(path)
+		}
+	case info.IsDir():
+		if !g.ignore.Ignored(path, true) {
+			g.reset()
+		}
+	case isMarkdownFile(path) && !g.ignore.Ignored(path, false):
+		g.reset()
+	}
+}
+
+// affects reports whether a change to path can change the graph: it is a
+// page, a directory or an ignore file, or it was removed and may have been a
+// directory
+func (g *LinkGraph) affects(path string) bool {
+	if isMarkdownFile(path) || isIgnoreFile(filepath.Base(path)) {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return !g.ignore.Ignored(path, false) && filepath.Ext(path) == ""
+	}
+	return info.IsDir() && !g.ignore.Ignored(path, true)
+}
+
+// Reset makes the next lookup rebuild the graph, for when links may resolve
+// to different pages, such as wiki links after a page was retitled
+func (g *LinkGraph) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reset()
+}
+
+// reset drops all pages. Caller must hold the write lock.
+func (g *LinkGraph) reset() {
+	if g.changed != nil {
+		// Links read by the build in progress may resolve differently now
+		g.changed[g.rootDir] = true
+	}
+	g.pages = make(map[string]linkedPage)
+	g.built = false
+}
+
+// Backlinks returns the pages that link to the markdown file at path, sorted
+// by title
+func (g *LinkGraph) Backlinks(path string) []Backlink {
+	g.ensureBuilt()
+	path = filepath.Clean(path)
+
+	g.mu.RLock()
+	var backlinks []Backlink
+	for source, page := range g.pages {
+		if !page.targets[path] {
+			continue
+		}
+		rel, err := filepath.Rel(g.rootDir, source)
+		if err != nil {
+			continue
+		}
+		backlinks = append(backlinks, Backlink{Title: page.title, Href: urlFromRelPath(rel)})
+	}
+	g.mu.RUnlock()
+
+	sort.Slice(backlinks, func(i, j int) bool {
+		a, b := backlinks[i], backlinks[j]
+		if ta, tb := strings.ToLower(a.Title), strings.ToLower(b.Title); ta != tb {
+			return ta < tb
+		}
+		return a.Href < b.Href
+	})
+	return backlinks
+}
+
+// pageLinks renders the markdown file at path and returns its title and the
+// markdown files its links lead to, resolved as mdserver check resolves them.
+// Pages that aren't served have no links, so they never show up as backlinks.
+func (s *Server) pageLinks(path string) (string, []string, bool) {
+	if !s.isValidPath(path) {
+		return "", nil, false
+	}
+	page, err := s.renderPageWith(path, s.pageCache.peek)
+	if err != nil {
+		return "", nil, false
+	}
+	var targets []string
+	for _, match := range linkAttrPattern.FindAllSubmatch(page.HTML, -1) {
+		link := html.UnescapeString(string(match[2]))
+		if string(match[1]) != "href" || !isLocalLink(link) {
+			continue
+		}
+		if target, _, problem := s.resolveLink(path, link); problem == "" && isMarkdownFile(target) {
+			targets = append(targets, target)
+		}
+	}
+	return page.Title, targets, true
+}
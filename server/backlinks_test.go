@@ -0,0 +1,268 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLinkGraphBacklinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md":         "# Home\n\n[Guide](docs/guide.md#usage) and [docs](docs/)\n",
+		"docs/README.md":    "# Docs\n\n[[guide]] [same](guide.md) [self](README.md) [top](#docs)\n",
+		"docs/guide.md":     "# Guide\n\n[home](/) [image](../logo.png) [site](https://example.com)\n",
+		"notes/design.md":   "# Design\n\n![logo](../logo.png) [guide](../docs/guide)\n",
+		"logo.png":          "png",
+		".private/spy.md":   "[guide](../docs/guide.md)\n",
+		"drafts/todo.md":    "[guide](../docs/guide.md)\n",
+		".mdserverignore":   "drafts/\n",
+		"notes/unlinked.md": "# Unlinked\n",
+	})
+	srv := NewServer(Config{RootDir: tmpDir})
+
+	tests := []struct {
+		page string
+		want []Backlink
+	}{
+		{"docs/guide.md", []Backlink{
+			{Title: "Design", Href: "/notes/design.md"},
+			{Title: "Docs", Href: "/docs/README.md"},
+			{Title: "Home", Href: "/README.md"},
+		}},
+		{"docs/README.md", []Backlink{{Title: "Home", Href: "/README.md"}}},
+		{"README.md", []Backlink{{Title: "Guide", Href: "/docs/guide.md"}}},
+		{"notes/unlinked.md", nil},
+	}
+	for _, tt := range tests {
+		got := srv.links.Backlinks(filepath.Join(tmpDir, tt.page))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Backlinks(%s) = %v, want %v", tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestLinkGraphUpdate(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md": "# Home\n\n[a](a.md) [b](b.md)\n",
+		"a.md":      "# A\n",
+	})
+	srv := NewServer(Config{RootDir: tmpDir})
+	backlinks := func(page string) []string {
+		var titles []string
+		for _, b := range srv.links.Backlinks(filepath.Join(tmpDir, page)) {
+			titles = append(titles, b.Title)
+		}
+		return titles
+	}
+	update := func(files map[string]string, path string) {
+		writeFiles(t, tmpDir, files)
+		srv.pageCache.invalidate(filepath.Join(tmpDir, path))
+		srv.links.Update(filepath.Join(tmpDir, path))
+	}
+
+	if got := backlinks("a.md"); !reflect.DeepEqual(got, []string{"Home"}) {
+		t.Fatalf("Backlinks(a.md) = %v", got)
+	}
+
+	// An edit rereads the edited page's links and title
+	update(map[string]string{"README.md": "# Start\n\n[b](b.md)\n"}, "README.md")
+	if got := backlinks("a.md"); got != nil {
+		t.Errorf("Expected the removed link to be gone, got %v", got)
+	}
+
+	// A new page picks up links that didn't resolve before
+	update(map[string]string{"b.md": "# B\n\n[a](a.md)\n"}, "b.md")
+	if got := backlinks("b.md"); !reflect.DeepEqual(got, []string{"Start"}) {
+		t.Errorf("Backlinks(b.md) = %v, want [Start]", got)
+	}
+	if got := backlinks("a.md"); !reflect.DeepEqual(got, []string{"B"}) {
+		t.Errorf("Backlinks(a.md) = %v, want [B]", got)
+	}
+
+	// A removed page no longer links anywhere
+	if err := os.Remove(filepath.Join(tmpDir, "b.md")); err != nil {
+		t.Fatal(err)
+	}
+	srv.links.Update(filepath.Join(tmpDir, "b.md"))
+	if got := backlinks("a.md"); got != nil {
+		t.Errorf("Expected no backlinks from a removed page, got %v", got)
+	}
+}
+
+func TestLinkGraphServingPolicy(t *testing.T) {
+	config := writeUnservedFixtures(t)
+	srv := NewServer(config)
+	guide := filepath.Join(config.RootDir, "guide.md")
+
+	if got := srv.links.Backlinks(guide); got != nil {
+		t.Errorf("Expected no backlinks from unserved files, got %v", got)
+	}
+	srv.links.Update(filepath.Join(config.RootDir, "leak.md"))
+	if got := srv.links.Backlinks(guide); got != nil {
+		t.Errorf("Expected no backlinks after an update, got %v", got)
+	}
+}
+
+func TestServeBacklinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md":     "# Home\n\nSee [[guide]].\n",
+		"docs/guide.md": "# Guide\n",
+	})
+	srv := NewServer(Config{RootDir: tmpDir})
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Body.String()
+	}
+
+	page := get("/docs/guide.md")
+	if !strings.Contains(page, "Linked from") || !strings.Contains(page, `<li><a href="/README.md">Home</a></li>`) {
+		t.Errorf("Expected a backlink to README.md, got %s", page)
+	}
+	if strings.Contains(get("/README.md"), "Linked from") {
+		t.Error("Pages nothing links to shouldn't show the backlinks panel")
+	}
+
+	// Exported backlinks point at the exported pages
+	outDir := t.TempDir()
+	if _, err := srv.Export(outDir); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	exported, err := os.ReadFile(filepath.Join(outDir, "docs", "guide.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(exported), `<a href="../README.html">Home</a>`) {
+		t.Errorf("Expected the exported backlink to point at ../README.html, got %s", exported)
+	}
+}
+
+func TestLinkGraphUpdatedByWatcher(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md": "# Home\n\n[a](a.md)\n",
+		"a.md":      "# A\n",
+	})
+	srv := NewServer(Config{RootDir: tmpDir, EnableLiveReload: true})
+	if srv.liveReload == nil {
+		t.Fatal("LiveReload was not initialized")
+	}
+	defer srv.Shutdown(context.Background())
+
+	page := filepath.Join(tmpDir, "a.md")
+	if got := srv.links.Backlinks(page); len(got) != 1 {
+		t.Fatalf("Expected 1 backlink, got %v", got)
+	}
+
+	writeFiles(t, tmpDir, map[string]string{"README.md": "# Home\n"})
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.links.Backlinks(page)) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Backlink was not removed after a watcher event")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestLinkGraphBuildOverlappingUpdate(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"a.md": "# A\n",
+		"b.md": "Old title",
+	})
+	a, b := filepath.Join(tmpDir, "a.md"), filepath.Join(tmpDir, "b.md")
+	reading, resume := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	links := func(path string) (string, []string, bool) {
+		once.Do(func() {
+			close(reading)
+			<-resume
+		})
+		if path != b {
+			return "A", nil, true
+		}
+		title, err := os.ReadFile(b)
+		return string(title), []string{a}, err == nil
+	}
+	g := NewLinkGraph(tmpDir, NewIgnoreMatcher(tmpDir, nil), func(string) bool { return true }, links)
+
+	result := make(chan []Backlink)
+	go func() { result <- g.Backlinks(a) }()
+	<-reading
+
+	// Updates don't wait for the build, and make it start over
+	writeFiles(t, tmpDir, map[string]string{"b.md": "New title"})
+	updated := make(chan struct{})
+	go func() {
+		g.Update(b)
+		close(updated)
+	}()
+	select {
+	case <-updated:
+	case <-time.After(time.Second):
+		t.Fatal("Update blocked on the build")
+	}
+	close(resume)
+
+	want := []Backlink{{Title: "New title", Href: "/b.md"}}
+	if got := <-result; !reflect.DeepEqual(got, want) {
+		t.Errorf("Backlinks() = %v, want %v", got, want)
+	}
+}
+
+func TestLinkGraphBuildFinishesUnderChurn(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"a.md":      "# A\n",
+		"b.md":      "# B\n",
+		"build.log": "",
+	})
+	a, b := filepath.Join(tmpDir, "a.md"), filepath.Join(tmpDir, "b.md")
+	links := func(path string) (string, []string, bool) {
+		time.Sleep(20 * time.Millisecond) // A slow render
+		if path == b {
+			return "B", []string{a}, true
+		}
+		return "A", nil, true
+	}
+
+	for _, churn := range []string{"build.log", "b.md"} {
+		t.Run(churn, func(t *testing.T) {
+			g := NewLinkGraph(tmpDir, NewIgnoreMatcher(tmpDir, nil), func(string) bool { return true }, links)
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				// Something keeps rewriting the file faster than the graph is built
+				for {
+					select {
+					case <-stop:
+						return
+					case <-time.After(5 * time.Millisecond):
+						g.Update(filepath.Join(tmpDir, churn))
+					}
+				}
+			}()
+
+			result := make(chan []Backlink, 1)
+			go func() { result <- g.Backlinks(a) }()
+			select {
+			case got := <-result:
+				if want := []Backlink{{Title: "B", Href: "/b.md"}}; !reflect.DeepEqual(got, want) {
+					t.Errorf("Backlinks() = %v, want %v", got, want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Backlinks() never returned while a file kept changing")
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStats holds counters for the settings page
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// fileCache memoizes values derived from files. Entries are keyed by path and
+// are only returned while the file's modification time and size still match,
+// so a stale entry is never served even if a watcher event is missed.
+type fileCache[T any] struct {
+	mu      sync.Mutex
+	entries map[string]fileCacheEntry[T]
+	hits    uint64
+	misses  uint64
+}
+
+type fileCacheEntry[T any] struct {
+	modTime time.Time
+	size    int64
+	value   T
+}
+
+func newFileCache[T any]() *fileCache[T] {
+	return &fileCache[T]{
+		entries: make(map[string]fileCacheEntry[T]),
+	}
+}
+
+// get returns the cached value for path if it was stored for the same mtime and size
+func (c *fileCache[T]) get(path string, info os.FileInfo) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[filepath.Clean(path)]
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		c.hits++
+		return entry.value, true
+	}
+	c.misses++
+	var zero T
+	return zero, false
+}
+
+// peek is get without counting a hit or miss, for lookups made on behalf of
+// other pages, such as building the link graph
+func (c *fileCache[T]) peek(path string, info os.FileInfo) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[filepath.Clean(path)]
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.value, true
+	}
+	var zero T
+	return zero, false
+}
+
+// put stores value for path at the given mtime and size
+func (c *fileCache[T]) put(path string, info os.FileInfo, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[filepath.Clean(path)] = fileCacheEntry[T]{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		value:   value,
+	}
+}
+
+// invalidate drops the entry for path, and any entries below it if path is a directory
+func (c *fileCache[T]) invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path = filepath.Clean(path)
+	delete(c.entries, path)
+	prefix := path + string(filepath.Separator)
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// stats returns the current hit/miss counters and entry count
+func (c *fileCache[T]) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: len(c.entries),
+	}
+}
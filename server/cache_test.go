@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "doc.md")
+	if err := os.WriteFile(path, []byte("# One\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+
+	cache := newFileCache[string]()
+
+	if _, ok := cache.get(path, info); ok {
+		t.Fatal("Expected miss on empty cache")
+	}
+	cache.put(path, info, "one")
+	if v, ok := cache.get(path, info); !ok || v != "one" {
+		t.Fatalf("Expected hit with %q, got %q (ok=%t)", "one", v, ok)
+	}
+
+	// A changed size or mtime must not return the stale entry
+	if err := os.WriteFile(path, []byte("# Two, longer\n"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	changed, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if _, ok := cache.get(path, changed); ok {
+		t.Error("Expected miss after file changed")
+	}
+
+	stats := cache.stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Invalidating a directory drops entries below it
+	cache.put(path, changed, "two")
+	cache.invalidate(tmpDir)
+	if stats := cache.stats(); stats.Entries != 0 {
+		t.Errorf("Expected empty cache after directory invalidation, got %d entries", stats.Entries)
+	}
+}
+
+func TestRenderCacheHitsAndSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte("# Doc\n\nBody.\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	srv := NewServer(Config{RootDir: tmpDir})
+	defer srv.Shutdown(context.Background())
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc.md", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Unexpected status code: %d", rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "Body.") {
+			t.Fatalf("Response body doesn't contain content. Got: %s", rec.Body.String())
+		}
+	}
+
+	stats := srv.pageCache.stats()
+	if stats.Misses != 1 || stats.Hits != 2 {
+		t.Errorf("Expected 1 miss and 2 hits, got %+v", stats)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	if !strings.Contains(rec.Body.String(), "Render Cache") {
+		t.Error("Settings page should show render cache statistics")
+	}
+}
+
+func TestRenderCacheInvalidatedByWatcher(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "doc.md")
+	if err := os.WriteFile(testFile, []byte("# Doc\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	srv := NewServer(Config{RootDir: tmpDir, EnableLiveReload: true})
+	if srv.liveReload == nil {
+		t.Fatal("LiveReload was not initialized")
+	}
+	defer srv.Shutdown(context.Background())
+
+	if _, err := srv.renderPage(testFile); err != nil {
+		t.Fatalf("renderPage() error = %v", err)
+	}
+	if stats := srv.pageCache.stats(); stats.Entries != 1 {
+		t.Fatalf("Expected 1 cached page, got %d", stats.Entries)
+	}
+
+	if err := os.WriteFile(testFile, []byte("# Doc\n\nChanged.\n"), 0644); err != nil {
+		t.Fatalf("Failed to update file: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.pageCache.stats().Entries != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Cache entry was not invalidated by watcher event")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mdserver/libs"
+)
+
+var (
+	// idAttrPattern matches id attributes in rendered HTML, including the
+	// heading IDs generated by goldmark
+	idAttrPattern = regexp.MustCompile(`\bid="([^"]*)"`)
+	// missingWikiLinkPattern matches wiki links whose page doesn't exist
+	missingWikiLinkPattern = regexp.MustCompile(`<span class="wikilink wikilink-missing" title="No page named ([^"]*)">`)
+)
+
+// LinkProblem is a broken link found by Check
+type LinkProblem struct {
+	File   string `json:"file"`   // Markdown file containing the link, relative to the root
+	Link   string `json:"link"`   // The link as rendered, or [[Page]] for wiki links
+	Reason string `json:"reason"` // What is wrong with it
+}
+
+// CheckReport is the result of Check
+type CheckReport struct {
+	Files    int           `json:"files"` // Markdown files checked
+	Links    int           `json:"links"` // Local links checked
+	Problems []LinkProblem `json:"problems"`
+}
+
+// Check renders every markdown file under the root directory and verifies
+// its local links and image sources: the target must be a file the server
+// would serve, and a #fragment must be an id in the target page, such as a
+// heading's. Links are resolved the way the server resolves requests, and
+// [[wiki links]] against the same index. External links aren't checked.
+func (s *Server) Check() (CheckReport, error) {
+	report := CheckReport{Problems: []LinkProblem{}}
+	rootDir, err := filepath.Abs(s.config.RootDir)
+	if err != nil {
+		return report, err
+	}
+
+	err = walkServedMarkdown(rootDir, s.ignore, s.policy.allowed, func(path string) error {
+		page, err := s.renderPage(path)
+		if err != nil {
+			return err
+		}
+		report.Files++
+		relPath, _ := filepath.Rel(rootDir, path)
+		relPath = filepath.ToSlash(relPath)
+		problem := func(link, reason string) {
+			report.Problems = append(report.Problems, LinkProblem{File: relPath, Link: link, Reason: reason})
+		}
+
+		for _, match := range missingWikiLinkPattern.FindAllSubmatch(page.HTML, -1) {
+			report.Links++
+			name := html.UnescapeString(string(match[1]))
+			problem("[["+name+"]]", "no page named "+name)
+		}
+		for _, match := range linkAttrPattern.FindAllSubmatch(page.HTML, -1) {
+			link := html.UnescapeString(string(match[2]))
+			if !isLocalLink(link) {
+				continue
+			}
+			report.Links++
+			if reason := s.checkLink(path, link); reason != "" {
+				problem(link, reason)
+			}
+		}
+		return nil
+	})
+	return report, err
+}
+
+// isLocalLink reports whether link points into the served tree
+func isLocalLink(link string) bool {
+	if link == "" || strings.HasPrefix(link, "//") {
+		return false
+	}
+	if i := strings.IndexAny(link, ":/?#"); i >= 0 && link[i] == ':' {
+		return false // Has a scheme (http:, mailto:, data:, ...)
+	}
+	return true
+}
+
+// checkLink returns why link, found in the markdown file at from, is broken,
+// or "" if it isn't
+func (s *Server) checkLink(from, link string) string {
+	target, fragment, problem := s.resolveLink(from, link)
+	if problem != "" || fragment == "" || target == "" {
+		return problem
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "not found"
+	}
+	if info.IsDir() {
+		return "#" + fragment + " points into a directory listing"
+	}
+	if !isMarkdownFile(target) {
+		return ""
+	}
+	page, err := s.renderPage(target)
+	if err != nil {
+		return "can't render target: " + err.Error()
+	}
+	for _, match := range idAttrPattern.FindAllSubmatch(page.HTML, -1) {
+		if html.UnescapeString(string(match[1])) == fragment {
+			return ""
+		}
+	}
+	return "no heading or anchor #" + fragment
+}
+
+// resolveLink returns the file that a local link in the markdown file at from
+// points to, resolved like a request for it, and the link's #fragment. A
+// directory resolves to its README.md or index.md unless fallback is disabled,
+// and links below /assets/ resolve as handleAssets serves them, with target ""
+// for the built-in stylesheet and client libraries. problem says why the link
+// is broken if the target doesn't exist or isn't served.
+func (s *Server) resolveLink(from, link string) (target, fragment, problem string) {
+	rawPath, fragment, _ := strings.Cut(link, "#")
+	rawPath, _, _ = strings.Cut(rawPath, "?")
+	linkPath, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return "", "", "invalid URL"
+	}
+	if fragment, err = url.PathUnescape(fragment); err != nil {
+		return "", "", "invalid URL"
+	}
+
+	if assetPath, ok := strings.CutPrefix(linkPath, "/assets/"); ok {
+		target, problem = s.resolveAsset(assetPath)
+		return target, fragment, problem
+	}
+
+	target = from
+	switch {
+	case strings.HasPrefix(linkPath, "/"):
+		target = filepath.Join(s.config.RootDir, filepath.FromSlash(linkPath))
+	case linkPath != "":
+		target = filepath.Join(filepath.Dir(from), filepath.FromSlash(linkPath))
+	}
+	info, err := os.Stat(target)
+	if err != nil && filepath.Ext(target) == "" {
+		if withExt, errExt := os.Stat(target + ".md"); errExt == nil {
+			target, info, err = target+".md", withExt, nil
+		}
+	}
+	if err != nil {
+		return "", "", "not found"
+	}
+	if target != filepath.Clean(s.config.RootDir) && !s.isValidPath(target) {
+		return "", "", "not served"
+	}
+	if info.IsDir() && !s.config.DisableFallback {
+		if fallback := findFallbackFile(target); fallback != "" {
+			target = fallback
+		}
+	}
+	return target, fragment, ""
+}
+
+// resolveAsset returns the file handleAssets serves for a path below
+// /assets/: a file relative to the root directory, or "" for the built-in
+// stylesheet and client libraries. problem is set as for resolveLink.
+func (s *Server) resolveAsset(assetPath string) (target, problem string) {
+	if assetPath == "style.css" {
+		return "", ""
+	}
+	if libPath, ok := strings.CutPrefix(assetPath, "vendor/"); ok && libs.IsFile(libPath) {
+		return "", ""
+	}
+	target = filepath.Join(s.config.RootDir, filepath.FromSlash(assetPath))
+	info, err := os.Stat(target)
+	if err != nil || info.IsDir() {
+		return "", "not found"
+	}
+	if !s.isValidPath(target) {
+		return "", "not served"
+	}
+	return target, ""
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md": "# Home\n\n## Setup\n\n## Setup\n\n" +
+			"[guide](docs/guide.md) [section](docs/guide.md#install-it) [no ext](docs/guide#usage)\n" +
+			"[self](#setup) [repeat](#setup-1) [docs](docs/) [site](https://example.com) [mail](mailto:a@b.c)\n" +
+			"![logo](img/logo.png) [[guide#Install it]]\n\n" +
+			"[gone](missing.md) [bad anchor](docs/guide.md#nope) [here](#nowhere) ![img](img/none.png)\n" +
+			"[key](server.key) [[Roadmap]] [[guide#Nothing]]\n" +
+			"![asset](/assets/img/logo.png) [css](/assets/style.css) ![no asset](/assets/none.png) [asset key](/assets/server.key)\n",
+		"docs/README.md":   "# Docs\n\n[up](../README.md#setup) [abs](/docs/guide.md) [space](my%20notes.md)\n",
+		"docs/guide.md":    "# Guide\n\n## Install it\n\n## Usage\n",
+		"docs/my notes.md": "# Notes\n",
+		"img/logo.png":     "png",
+		"server.key":       "secret",
+		"skip/bad.md":      "[gone](nothing.md)\n",
+		".gitignore":       "skip/\n",
+	})
+
+	srv := NewServer(Config{RootDir: tmpDir})
+	report, err := srv.Check()
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if report.Files != 4 {
+		t.Errorf("Files = %d, want 4", report.Files)
+	}
+
+	want := map[string]string{
+		"missing.md":             "not found",
+		"docs/guide.md#nope":     "no heading or anchor #nope",
+		"#nowhere":               "no heading or anchor #nowhere",
+		"img/none.png":           "not found",
+		"server.key":             "not served",
+		"[[Roadmap]]":            "no page named Roadmap",
+		"/docs/guide.md#nothing": "no heading or anchor #nothing",
+		"/assets/none.png":       "not found",
+		"/assets/server.key":     "not served",
+	}
+	got := make(map[string]string)
+	for _, p := range report.Problems {
+		if p.File != "README.md" {
+			t.Errorf("Unexpected problem in %s: %q %s", p.File, p.Link, p.Reason)
+			continue
+		}
+		got[p.Link] = p.Reason
+	}
+	for link, reason := range want {
+		if got[link] != reason {
+			t.Errorf("Problem for %q = %q, want %q", link, got[link], reason)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("Got problems %v, want %v", got, want)
+	}
+}
+
+func TestCheckDisableFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md":      "[docs](docs/#intro)\n",
+		"docs/README.md": "# Intro\n",
+	})
+
+	report, err := NewServer(Config{RootDir: tmpDir}).Check()
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("Expected the fallback README to have #intro, got %v", report.Problems)
+	}
+
+	report, err = NewServer(Config{RootDir: tmpDir, DisableFallback: true}).Check()
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(report.Problems) != 1 {
+		t.Errorf("Expected a fragment into a directory listing to be reported, got %v", report.Problems)
+	}
+
+	// Removing the target breaks the link
+	if err := os.RemoveAll(filepath.Join(tmpDir, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = NewServer(Config{RootDir: tmpDir}).Check()
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Reason != "not found" {
+		t.Errorf("Expected docs/ to be not found, got %v", report.Problems)
+	}
+}
@@ -1,14 +1,18 @@
 package server
 
 import (
+	"context"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"mdserver/libs"
 )
 
 func TestServeMarkdownContent(t *testing.T) {
@@ -63,7 +67,7 @@ func TestServeMarkdownContent(t *testing.T) {
 	// Start server in a goroutine
 	serverErr := make(chan error, 1)
 	go func() {
-		serverErr <- srv.Start()
+		serverErr <- srv.Start(context.Background())
 	}()
 
 	// Give server time to start
@@ -71,7 +75,7 @@ func TestServeMarkdownContent(t *testing.T) {
 
 	// Ensure server is stopped at the end
 	defer func() {
-		srv.Stop()
+		srv.Shutdown(context.Background())
 		time.Sleep(50 * time.Millisecond)
 	}()
 
@@ -150,9 +154,12 @@ func TestServeMarkdownContent(t *testing.T) {
 			t.Error("Response should contain rendered link")
 		}
 
-		// Verify code blocks are rendered
-		if !strings.Contains(html, `<pre><code`) || !strings.Contains(html, `package main`) {
-			t.Error("Response should contain rendered code block")
+		// Verify code blocks are rendered with syntax highlighting
+		if !strings.Contains(html, `<pre class="chroma"><code class="language-go">`) {
+			t.Error("Response should contain highlighted code block")
+		}
+		if !strings.Contains(html, `<span class="kn">package</span>`) {
+			t.Error("Response should contain highlighted keyword token")
 		}
 
 		// Verify lists are rendered
@@ -225,6 +232,11 @@ func TestServeMarkdownContent(t *testing.T) {
 			}
 		}
 
+		// Verify code highlighting classes are appended
+		if !strings.Contains(css, ".chroma") {
+			t.Error("CSS should contain code highlighting rules")
+		}
+
 		// Check if this is the full CSS (from template/style.css) or default CSS
 		isDefaultCSS := strings.Contains(css, "Default CSS")
 		
@@ -324,12 +336,12 @@ func TestServeMarkdownWithMermaid(t *testing.T) {
 
 	// Start server in a goroutine
 	go func() {
-		_ = srv.Start()
+		_ = srv.Start(context.Background())
 	}()
 
 	time.Sleep(100 * time.Millisecond)
 	defer func() {
-		srv.Stop()
+		srv.Shutdown(context.Background())
 		time.Sleep(50 * time.Millisecond)
 	}()
 
@@ -407,12 +419,12 @@ func TestServeDirectoryIndex(t *testing.T) {
 
 	// Start server in a goroutine
 	go func() {
-		_ = srv.Start()
+		_ = srv.Start(context.Background())
 	}()
 
 	time.Sleep(100 * time.Millisecond)
 	defer func() {
-		srv.Stop()
+		srv.Shutdown(context.Background())
 		time.Sleep(50 * time.Millisecond)
 	}()
 
@@ -457,3 +469,242 @@ func TestServeDirectoryIndex(t *testing.T) {
 		t.Error("Directory listing should include CSS link")
 	}
 }
+
+func TestEntryFileAndFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	docsDir := filepath.Join(tmpDir, "docs")
+	plainDir := filepath.Join(tmpDir, "plain")
+	for _, dir := range []string{docsDir, plainDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(tmpDir, "README.md"):  "# Root Readme\n",
+		filepath.Join(docsDir, "index.md"):  "# Docs Index\n",
+		filepath.Join(docsDir, "guide.md"):  "# Guide\n",
+		filepath.Join(plainDir, "notes.md"): "# Notes\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	get := func(srv *Server, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	t.Run("fallback files", func(t *testing.T) {
+		srv := NewServer(Config{RootDir: tmpDir})
+
+		tests := []struct {
+			path string
+			want string
+		}{
+			{"/", "Root Readme"},
+			{"/docs/", "Docs Index"},
+			{"/plain/", `class="directory-listing"`},
+		}
+		for _, tt := range tests {
+			rec := get(srv, tt.path)
+			if rec.Code != http.StatusOK {
+				t.Errorf("GET %s: unexpected status %d", tt.path, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("GET %s: expected %q in body", tt.path, tt.want)
+			}
+		}
+	})
+
+	t.Run("fallback disabled", func(t *testing.T) {
+		srv := NewServer(Config{RootDir: tmpDir, DisableFallback: true})
+
+		for _, path := range []string{"/", "/docs/"} {
+			rec := get(srv, path)
+			if !strings.Contains(rec.Body.String(), `class="directory-listing"`) {
+				t.Errorf("GET %s: expected directory listing", path)
+			}
+		}
+	})
+
+	t.Run("entry file", func(t *testing.T) {
+		srv := NewServer(Config{RootDir: tmpDir, File: filepath.Join(docsDir, "guide.md")})
+
+		rec := get(srv, "/")
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Expected redirect, got status %d", rec.Code)
+		}
+		if loc := rec.Header().Get("Location"); loc != "/docs/guide.md" {
+			t.Errorf("Expected redirect to /docs/guide.md, got %q", loc)
+		}
+	})
+}
+
+func TestServeMarkdownWithFrontMatter(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "---\ntitle: Meta Title\ndescription: Short summary\n---\n# Heading Title\n\nBody.\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	srv := NewServer(Config{RootDir: tmpDir})
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc.md", nil))
+	html := rec.Body.String()
+
+	if !strings.Contains(html, "<title>Meta Title</title>") {
+		t.Error("Front matter title should take precedence over the first heading")
+	}
+	if !strings.Contains(html, `<meta name="description" content="Short summary">`) {
+		t.Error("Front matter should be available to the template as .Meta")
+	}
+	if strings.Contains(html, "description: Short summary") {
+		t.Error("Front matter should be stripped from the rendered body")
+	}
+}
+
+func TestServeMarkdownTOCSidebar(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "# Spec\n\n## Goals\n\n### Non-goals\n\n## Design\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "spec.md"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "plain.md"), []byte("No headings here.\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	srv := NewServer(Config{RootDir: tmpDir})
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/spec.md", nil))
+	html := rec.Body.String()
+
+	want := `<nav class="toc" id="toc"><ul><li><a href="#spec">Spec</a><ul><li><a href="#goals">Goals</a><ul><li><a href="#non-goals">Non-goals</a></li></ul></li><li><a href="#design">Design</a></li></ul></li></ul></nav>`
+	if !strings.Contains(html, want) {
+		t.Errorf("Expected nested TOC sidebar %s, got: %s", want, html)
+	}
+	if !strings.Contains(html, `<body class="has-toc">`) {
+		t.Error("Pages with a TOC should use the sidebar layout")
+	}
+
+	rec = httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plain.md", nil))
+	if strings.Contains(rec.Body.String(), `class="toc"`) {
+		t.Error("Pages without headings should have no TOC sidebar")
+	}
+}
+
+func TestServeMarkdownMath(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "# Notes\n\nInline $a_1 * b_1$ and display:\n\n$$\n\\int_0^1 x\\,dx\n$$\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "notes.md"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	srv := NewServer(Config{RootDir: tmpDir, EnableLiveReload: true, ReloadMode: ReloadModePatch})
+	defer srv.Shutdown(context.Background())
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/notes.md", nil))
+	html := rec.Body.String()
+
+	for _, want := range []string{
+		`<span class="math math-inline">a_1 * b_1</span>`,
+		`<div class="math math-display">\int_0^1 x\,dx`,
+		"katex.min.js",
+		"renderMath(content)", // Patched content is typeset again
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected page to contain %q, got: %s", want, html)
+		}
+	}
+}
+
+func TestServeVendorLibraries(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte("# Doc\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	srv := NewServer(Config{RootDir: tmpDir})
+
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc.md", nil))
+	for _, path := range []string{libs.MermaidJS, libs.KaTeXCSS, libs.KaTeXJS} {
+		if !strings.Contains(rec.Body.String(), "/assets/vendor/"+path) {
+			t.Errorf("Expected page to load /assets/vendor/%s", path)
+		}
+	}
+
+	for _, path := range libs.Files() {
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/vendor/"+path, nil))
+		if data, bundled := libs.Read(path); bundled {
+			if rec.Code != http.StatusOK || rec.Body.Len() != len(data) {
+				t.Errorf("GET %s = %d with %d bytes, want %d with %d bytes", path, rec.Code, rec.Body.Len(), http.StatusOK, len(data))
+			}
+		} else if rec.Code != http.StatusFound || rec.Header().Get("Location") != libs.CDNURL(path) {
+			t.Errorf("GET %s = %d to %q, want redirect to %s", path, rec.Code, rec.Header().Get("Location"), libs.CDNURL(path))
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/vendor/mermaid@1.0.0/mermaid.min.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Unknown library status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestThemeSelection(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte("# Doc\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	get := func(srv *Server, path string) string {
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Body.String()
+	}
+
+	srv := NewServer(Config{RootDir: tmpDir})
+	for _, path := range []string{"/doc.md", "/", "/search?q=doc", "/settings"} {
+		if html := get(srv, path); !strings.Contains(html, `<html lang="en" data-theme="auto">`) {
+			t.Errorf("%s: expected default auto theme", path)
+		}
+	}
+
+	srv = NewServer(Config{RootDir: tmpDir, Theme: "dark"})
+	if html := get(srv, "/doc.md"); !strings.Contains(html, `data-theme="dark"`) {
+		t.Error("Expected configured dark theme")
+	}
+	if css := get(srv, "/assets/style.css"); !strings.Contains(css, `:root[data-theme="dark"] .chroma`) {
+		t.Error("Stylesheet should include the dark code highlighting theme")
+	}
+
+	// Switching the theme from the settings page applies to later requests
+	form := strings.NewReader("theme=light&csrf_token=" + srv.csrfToken)
+	req := httptest.NewRequest(http.MethodPost, "/settings/theme", form)
+	req.Host = "localhost"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after changing theme, got %d", rec.Code)
+	}
+	if html := get(srv, "/doc.md"); !strings.Contains(html, `data-theme="light"`) {
+		t.Error("Expected theme changed to light")
+	}
+	if html := get(srv, "/settings"); !strings.Contains(html, `<option value="light" selected>`) {
+		t.Error("Settings page should show the current theme as selected")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/settings/theme", strings.NewReader("theme=sepia&csrf_token="+srv.csrfToken))
+	req.Host = "localhost"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown theme, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// csrfField is the name of the hidden settings form field holding the CSRF token
+const csrfField = "csrf_token"
+
+// hostNames returns the Host header names the server answers to besides IP
+// addresses and localhost: the --host name, this machine's name and any
+// configured extra names
+func hostNames(config Config) map[string]bool {
+	names := make(map[string]bool)
+	add := func(name string) {
+		if name != "" {
+			names[strings.ToLower(strings.TrimSuffix(name, "."))] = true
+		}
+	}
+	add(config.Host)
+	if hostname, err := os.Hostname(); err == nil {
+		add(hostname)
+		add(hostname + ".local") // mDNS
+	}
+	for _, name := range config.AllowedHosts {
+		add(name)
+	}
+	return names
+}
+
+// validHost reports whether r was addressed to this server by one of its
+// names. A page on another domain that rebinds its DNS name to this machine's
+// address still sends its own name, so checking the Host header defeats DNS
+// rebinding.
+func (s *Server) validHost(r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	if net.ParseIP(host) != nil || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	return s.hostNames[host]
+}
+
+// sameOrigin reports whether r may have come from a page served by this
+// server: browsers send the page's origin with POSTs and WebSocket handshakes,
+// and requests from other tools send none
+func sameOrigin(r *http.Request) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// protect wraps handlers that change server state or hold a live connection.
+// It rejects requests with an unknown Host header or from another origin, and
+// POSTs without the CSRF token from the settings forms.
+func (s *Server) protect(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.validHost(r) {
+			http.Error(w, "Unknown host "+r.Host+" (see --allow-host)", http.StatusForbidden)
+			return
+		}
+		if !sameOrigin(r) {
+			http.Error(w, "Cross-origin request", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPost && !s.validCSRFToken(r.PostFormValue(csrfField)) {
+			http.Error(w, "Invalid or missing CSRF token; reload the settings page and try again", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) validCSRFToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.csrfToken)) == 1
+}
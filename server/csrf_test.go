@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSettingsFormsProtected(t *testing.T) {
+	srv := NewServer(Config{RootDir: t.TempDir(), Host: "0.0.0.0", AllowedHosts: []string{"docs.example.com"}})
+	token := srv.csrfToken
+
+	req := httptest.NewRequest(http.MethodGet, "/settings", nil)
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+	if want := `name="csrf_token" value="` + token + `"`; strings.Count(rec.Body.String(), want) != 2 {
+		t.Errorf("Settings forms should carry the CSRF token %s", want)
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		token   string
+		headers map[string]string
+		want    int
+	}{
+		{"valid", "localhost:8080", token, nil, http.StatusSeeOther},
+		{"same origin", "localhost:8080", token, map[string]string{"Origin": "http://localhost:8080", "Sec-Fetch-Site": "same-origin"}, http.StatusSeeOther},
+		{"IP address", "192.168.1.20:8080", token, map[string]string{"Origin": "http://192.168.1.20:8080"}, http.StatusSeeOther},
+		{"IPv6 address", "[::1]:8080", token, nil, http.StatusSeeOther},
+		{"allowed host", "docs.example.com", token, map[string]string{"Origin": "https://docs.example.com"}, http.StatusSeeOther},
+		{"missing token", "localhost:8080", "", nil, http.StatusForbidden},
+		{"wrong token", "localhost:8080", "guess", nil, http.StatusForbidden},
+		{"other origin", "localhost:8080", token, map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"other port", "localhost:8080", token, map[string]string{"Origin": "http://localhost:9090"}, http.StatusForbidden},
+		{"null origin", "localhost:8080", token, map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"cross-site fetch", "localhost:8080", token, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"DNS rebinding", "evil.example:8080", token, map[string]string{"Origin": "http://evil.example:8080"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/settings/theme", strings.NewReader("theme=dark&csrf_token="+tt.token))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Host = tt.host
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			srv.mux.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	for _, path := range []string{"/settings/shutdown", "/settings/remove-watch"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("dir=/tmp"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Host = "localhost"
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("POST %s without a CSRF token: status %d, want %d", path, rec.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestLiveReloadOriginCheck(t *testing.T) {
+	port, err := findAvailablePort()
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	srv := NewServer(Config{Host: "localhost", Port: port, RootDir: t.TempDir(), EnableLiveReload: true})
+	go func() {
+		_ = srv.Start(context.Background())
+	}()
+	defer srv.Shutdown(context.Background())
+	time.Sleep(100 * time.Millisecond)
+
+	addr := "localhost:" + strconv.Itoa(port)
+	tests := []struct {
+		name   string
+		header http.Header
+		ok     bool
+	}{
+		{"no origin", nil, true},
+		{"same origin", http.Header{"Origin": {"http://" + addr}}, true},
+		{"other origin", http.Header{"Origin": {"https://evil.example"}}, false},
+		{"DNS rebinding", http.Header{"Host": {"evil.example:" + strconv.Itoa(port)}, "Origin": {"http://evil.example:" + strconv.Itoa(port)}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, resp, err := websocket.DefaultDialer.Dial("ws://"+addr+"/livereload", tt.header)
+			if conn != nil {
+				conn.Close()
+			}
+			if tt.ok && err != nil {
+				t.Errorf("Handshake failed: %v", err)
+			}
+			if !tt.ok && (err == nil || resp == nil || resp.StatusCode != http.StatusForbidden) {
+				t.Errorf("Handshake should be refused with 403, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mdserver/libs"
+)
+
+// linkAttrPattern matches href and src attributes in rendered HTML
+var linkAttrPattern = regexp.MustCompile(`\b(href|src)="([^"]*)"`)
+
+// ExportStats summarizes a static site export
+type ExportStats struct {
+	Pages       int
+	Directories int
+	Assets      int
+}
+
+// Export writes the served tree to outDir as a static site: every markdown
+// file rendered through page.html, an index.html for each directory, the
+// stylesheet and favicon, and copies of all other files. Links to .md files
+// are rewritten to .html and root-relative links are made relative so the
+// site works from any base path or straight from disk.
+func (s *Server) Export(outDir string) (ExportStats, error) {
+	var stats ExportStats
+
+	outDir, err := filepath.Abs(outDir)
+	if err != nil {
+		return stats, err
+	}
+	rootDir, err := filepath.Abs(s.config.RootDir)
+	if err != nil {
+		return stats, err
+	}
+
+	pageTmpl, err := s.loadTemplate("page.html")
+	if err != nil {
+		return stats, fmt.Errorf("load page template: %w", err)
+	}
+	dirTmpl, err := s.loadTemplate("directory.html")
+	if err != nil {
+		return stats, fmt.Errorf("load directory template: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(outDir, "assets"), 0755); err != nil {
+		return stats, err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "assets", "style.css"), s.stylesheet(), 0644); err != nil {
+		return stats, err
+	}
+	for _, name := range []string{"favicon.svg", "favicon.ico"} {
+		if err := os.WriteFile(filepath.Join(outDir, name), s.favicon(), 0644); err != nil {
+			return stats, err
+		}
+	}
+	for _, path := range libs.Files() {
+		data, ok := libs.Read(path)
+		if !ok {
+			continue // Pages link to the CDN instead, see exportLink
+		}
+		dst := filepath.Join(outDir, "assets", "vendor", filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return stats, err
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return stats, err
+		}
+	}
+
+	// Files and directories the server wouldn't serve aren't exported either
+	err = walkServed(rootDir, s.ignore, s.policy.allowed, func(path string, d fs.DirEntry) error {
+		relPath, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+
+		if d.IsDir() {
+			// Don't export the output into itself
+			if path == outDir {
+				return filepath.SkipDir
+			}
+			if err := os.MkdirAll(filepath.Join(outDir, relPath), 0755); err != nil {
+				return err
+			}
+			if err := s.exportDirectory(dirTmpl, pageTmpl, path, relPath, outDir); err != nil {
+				return fmt.Errorf("%s: %w", relPath, err)
+			}
+			stats.Directories++
+			return nil
+		}
+
+		if isMarkdownFile(name) {
+			data, err := s.markdownPageData(path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", relPath, err)
+			}
+			if err := s.exportPage(pageTmpl, data, relPath, htmlPath(relPath), outDir); err != nil {
+				return fmt.Errorf("%s: %w", relPath, err)
+			}
+			stats.Pages++
+			return nil
+		}
+
+		if err := copyFile(path, filepath.Join(outDir, relPath)); err != nil {
+			return fmt.Errorf("%s: %w", relPath, err)
+		}
+		stats.Assets++
+		return nil
+	})
+
+	return stats, err
+}
+
+// exportDirectory writes index.html for a directory: its README.md or index.md
+// when fallback is enabled (matching what the server shows), otherwise the listing
+func (s *Server) exportDirectory(dirTmpl, pageTmpl *template.Template, dirPath, relDir, outDir string) error {
+	indexPath := filepath.Join(relDir, "index.html")
+
+	if !s.config.DisableFallback {
+		if fallback := findFallbackFile(dirPath); fallback != "" && s.isValidPath(fallback) {
+			data, err := s.markdownPageData(fallback)
+			if err != nil {
+				return err
+			}
+			return s.exportPage(pageTmpl, data, filepath.Join(relDir, filepath.Base(fallback)), indexPath, outDir)
+		}
+	}
+
+	// index.md is exported as index.html itself, so don't overwrite it with a listing
+	index := filepath.Join(dirPath, "index.md")
+	if _, err := os.Stat(index); err == nil && s.isValidPath(index) {
+		log.Printf("export: %s has index.md; skipping directory listing", relDir)
+		return nil
+	}
+
+	data, err := s.directoryPageData(dirPath)
+	if err != nil {
+		return err
+	}
+	data.Static = true
+	return s.writeExportedHTML(dirTmpl, data, filepath.Join(dirPath, "index.html"), indexPath, outDir)
+}
+
+// exportPage writes a rendered markdown page to outRel under outDir
+func (s *Server) exportPage(tmpl *template.Template, data pageData, relPath, outRel, outDir string) error {
+	log.Printf("export: %s", relPath)
+	data.Static = true
+	return s.writeExportedHTML(tmpl, data, filepath.Join(s.config.RootDir, relPath), outRel, outDir)
+}
+
+// writeExportedHTML executes tmpl and writes the result with links rewritten
+// for a static site. Relative links are resolved against the served file
+// from, the markdown file of a page or a file in a listed directory.
+func (s *Server) writeExportedHTML(tmpl *template.Template, data any, from, outRel, outDir string) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	depth := strings.Count(filepath.ToSlash(outRel), "/")
+	html := s.rewriteExportLinks(buf.Bytes(), from, depth)
+	return os.WriteFile(filepath.Join(outDir, outRel), html, 0644)
+}
+
+// rewriteExportLinks rewrites href and src attributes for a page exported
+// from the file at from, at the given directory depth below the site root
+func (s *Server) rewriteExportLinks(html []byte, from string, depth int) []byte {
+	return linkAttrPattern.ReplaceAllFunc(html, func(match []byte) []byte {
+		sub := linkAttrPattern.FindSubmatch(match)
+		link := exportLink(s.servedLink(string(sub[2]), from), depth)
+		return []byte(fmt.Sprintf(`%s="%s"`, sub[1], link))
+	})
+}
+
+// servedLink rewrites a local link in a page exported from the file at from
+// to point at the file the server serves for it, where the link doesn't name
+// that file: page links without the .md extension get it, and links to files
+// below /assets/ become links to the file in the tree, as resolveLink
+// resolves them. exportLink then converts the result for the static site.
+func (s *Server) servedLink(link, from string) string {
+	if !isLocalLink(link) || strings.HasPrefix(link, "#") {
+		return link
+	}
+	target, _, problem := s.resolveLink(from, html.UnescapeString(link))
+	if problem != "" || target == "" {
+		return link // Broken, or built in like the stylesheet
+	}
+
+	path, suffix := link, ""
+	if i := strings.IndexAny(link, "?#"); i >= 0 {
+		path, suffix = link[:i], link[i:]
+	}
+	if assetPath, ok := strings.CutPrefix(path, "/assets/"); ok {
+		return "/" + assetPath + suffix
+	}
+	if linkPath, err := url.PathUnescape(html.UnescapeString(path)); err == nil && filepath.Base(target) == filepath.Base(linkPath)+".md" {
+		return path + ".md" + suffix
+	}
+	return link
+}
+
+// exportLink converts a link in served HTML to its static site equivalent.
+// External links and fragment-only links are returned unchanged, and client
+// libraries missing from this build link to the CDN.
+func exportLink(link string, depth int) string {
+	if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "//") {
+		return link
+	}
+	if i := strings.IndexAny(link, ":/?#"); i >= 0 && link[i] == ':' {
+		return link // Has a scheme (http:, mailto:, data:, ...)
+	}
+
+	if libPath, ok := strings.CutPrefix(link, "/assets/vendor/"); ok && libs.IsFile(libPath) {
+		if _, bundled := libs.Read(libPath); !bundled {
+			return libs.CDNURL(libPath)
+		}
+	}
+
+	path, suffix := link, ""
+	if i := strings.IndexAny(link, "?#"); i >= 0 {
+		path, suffix = link[:i], link[i:]
+	}
+
+	absolute := strings.HasPrefix(path, "/")
+	if absolute {
+		path = strings.Repeat("../", depth) + strings.TrimPrefix(path, "/")
+	}
+
+	switch {
+	case (absolute && path == "") || strings.HasSuffix(path, "/"):
+		path += "index.html"
+	case isMarkdownFile(path):
+		path = htmlPath(path)
+	}
+	return path + suffix
+}
+
+// htmlPath replaces a .md extension with .html
+func htmlPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".html"
+}
+
+// copyFile copies src to dst, preserving the file mode
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
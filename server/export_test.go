@@ -0,0 +1,190 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mdserver/libs"
+)
+
+func TestExportLink(t *testing.T) {
+	// Client libraries are exported when bundled, otherwise loaded from the CDN
+	mermaidLink := libs.CDNURL(libs.MermaidJS)
+	if _, bundled := libs.Read(libs.MermaidJS); bundled {
+		mermaidLink = "../assets/vendor/" + libs.MermaidJS
+	}
+
+	tests := []struct {
+		link  string
+		depth int
+		want  string
+	}{
+		{"guide.md", 0, "guide.html"},
+		{"guide.md#setup", 0, "guide.html#setup"},
+		{"../README.md", 1, "../README.html"},
+		{"/docs/guide.md", 1, "../docs/guide.html"},
+		{"/", 0, "index.html"},
+		{"/", 2, "../../index.html"},
+		{"/docs/", 0, "docs/index.html"},
+		{"/assets/style.css", 1, "../assets/style.css"},
+		{"/assets/vendor/" + libs.MermaidJS, 1, mermaidLink},
+		{"image.png", 0, "image.png"},
+		{"#section", 0, "#section"},
+		{"https://example.com/file.md", 0, "https://example.com/file.md"},
+		{"mailto:someone@example.com", 0, "mailto:someone@example.com"},
+		{"//cdn.example.com/x.js", 0, "//cdn.example.com/x.js"},
+	}
+
+	for _, tt := range tests {
+		if got := exportLink(tt.link, tt.depth); got != tt.want {
+			t.Errorf("exportLink(%q, %d) = %q, want %q", tt.link, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	rootDir := t.TempDir()
+	files := map[string]string{
+		"README.md":         "# Home\n\nSee the [guide](docs/guide.md#setup).\n",
+		"docs/guide.md":     "# Guide\n\n![diagram](diagram.png)\n\nBack to [home](../README.md).\n",
+		"docs/diagram.png":  "png-bytes",
+		"notes/todo.md":     "# Todo\n",
+		".git/config":       "hidden",
+		"node_modules/x.md": "# Vendored\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(rootDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	// Export into a directory inside the root to check it isn't exported into itself
+	outDir := filepath.Join(rootDir, "site")
+	srv := NewServer(Config{RootDir: rootDir})
+	stats, err := srv.Export(outDir)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if stats.Pages != 4 || stats.Assets != 1 {
+		t.Errorf("Unexpected export stats: %+v", stats)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatalf("Expected %s to be exported: %v", name, err)
+		}
+		return string(content)
+	}
+
+	guide := read("docs/guide.html")
+	if !strings.Contains(guide, `href="../README.html"`) {
+		t.Error("Relative .md links should be rewritten to .html")
+	}
+	if !strings.Contains(guide, `href="../assets/style.css"`) {
+		t.Error("Stylesheet link should be relative to the page")
+	}
+	if strings.Contains(guide, `action="/search"`) || strings.Contains(guide, `href="/settings"`) {
+		t.Error("Server-only controls should be omitted from exported pages")
+	}
+
+	// README.md is the root index page, as it is when served
+	index := read("index.html")
+	if !strings.Contains(index, `href="docs/guide.html#setup"`) {
+		t.Error("Links in the fallback index page should be rewritten")
+	}
+	read("README.html")
+
+	// Directories without a fallback file get a listing
+	listing := read("notes/index.html")
+	if !strings.Contains(listing, `href="../notes/todo.html"`) {
+		t.Errorf("Directory listing should link to exported pages, got %s", listing)
+	}
+
+	if read("docs/diagram.png") != "png-bytes" {
+		t.Error("Assets should be copied unchanged")
+	}
+	if !strings.Contains(read("assets/style.css"), ".chroma") {
+		t.Error("Stylesheet should be exported")
+	}
+
+	// Directories only the watcher skips are exported like any other
+	if !strings.Contains(read("node_modules/x.html"), "Vendored") {
+		t.Error("node_modules/x.md should be exported")
+	}
+
+	for _, name := range []string{".git/config", "site/index.html"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err == nil {
+			t.Errorf("%s should not be exported", name)
+		}
+	}
+}
+
+func TestExportServingPolicy(t *testing.T) {
+	config := writeUnservedFixtures(t)
+	writeFiles(t, config.RootDir, map[string]string{"private/README.md": "# Private\n"})
+	srv := NewServer(config)
+	outDir := t.TempDir()
+	if _, err := srv.Export(outDir); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	for _, name := range []string{"leak.html", "private/index.html", "private/plan.html", "private/README.html"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err == nil {
+			t.Errorf("%s should not be exported", name)
+		}
+	}
+	index, err := os.ReadFile(filepath.Join(outDir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), "private") || strings.Contains(string(index), "leak") {
+		t.Errorf("Root page shouldn't link to unserved files, got %s", index)
+	}
+}
+
+func TestExportResolvesLinks(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFiles(t, rootDir, map[string]string{
+		"README.md":        "# Home\n\n[Guide](docs/guide) [Usage](/docs/guide#usage) [Docs](docs)\n\n![pic](/assets/img/pic.png) [css](/assets/style.css)\n",
+		"docs/guide.md":    "# Guide\n\n## Usage\n\n[Notes](my%20notes) ![pic](/assets/img/pic.png)\n",
+		"docs/my notes.md": "# Notes\n",
+		"docs/index.md":    "# Docs\n",
+		"img/pic.png":      "png",
+	})
+	outDir := t.TempDir()
+	if _, err := NewServer(Config{RootDir: rootDir}).Export(outDir); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	tests := []struct {
+		page  string
+		links []string
+	}{
+		{"README.html", []string{`href="docs/guide.html"`, `href="docs/guide.html#usage"`, `href="docs"`, `src="img/pic.png"`, `href="assets/style.css"`}},
+		{"docs/guide.html", []string{`href="my%20notes.html"`, `src="../img/pic.png"`}},
+	}
+	for _, tt := range tests {
+		content, err := os.ReadFile(filepath.Join(outDir, tt.page))
+		if err != nil {
+			t.Fatalf("Expected %s to be exported: %v", tt.page, err)
+		}
+		for _, link := range tt.links {
+			if !strings.Contains(string(content), link) {
+				t.Errorf("Expected %s in %s, got %s", link, tt.page, content)
+			}
+		}
+	}
+	for _, name := range []string{"docs/guide.html", "docs/my notes.html", "img/pic.png"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("Expected the link target %s to be exported: %v", name, err)
+		}
+	}
+}
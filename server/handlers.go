@@ -1,22 +1,21 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
+	"mdserver/libs"
 	"mdserver/renderer"
 )
 
-// settingsGearIcon is the SVG markup for the settings gear icon used in breadcrumbs.
-const settingsGearIcon = `<svg width="16" height="16" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round"><circle cx="12" cy="12" r="3"></circle><path d="M19.4 15a1.65 1.65 0 0 0 .33 1.82l.06.06a2 2 0 0 1-2.83 2.83l-.06-.06a1.65 1.65 0 0 0-1.82-.33 1.65 1.65 0 0 0-1 1.51V21a2 2 0 0 1-4 0v-.09A1.65 1.65 0 0 0 9 19.4a1.65 1.65 0 0 0-1.82.33l-.06.06a2 2 0 0 1-2.83-2.83l.06-.06A1.65 1.65 0 0 0 4.68 15a1.65 1.65 0 0 0-1.51-1H3a2 2 0 0 1 0-4h.09A1.65 1.65 0 0 0 4.6 9a1.65 1.65 0 0 0-.33-1.82l-.06-.06a2 2 0 0 1 2.83-2.83l.06.06A1.65 1.65 0 0 0 9 4.68a1.65 1.65 0 0 0 1-1.51V3a2 2 0 0 1 4 0v.09a1.65 1.65 0 0 0 1 1.51 1.65 1.65 0 0 0 1.82-.33l.06-.06a2 2 0 0 1 2.83 2.83l-.06.06A1.65 1.65 0 0 0 19.4 9a1.65 1.65 0 0 0 1.51 1H21a2 2 0 0 1 0 4h-.09a1.65 1.65 0 0 0-1.51 1z"></path></svg>`
-
 // Breadcrumb represents a single breadcrumb navigation item
 type Breadcrumb struct {
 	Href string
@@ -25,26 +24,73 @@ type Breadcrumb struct {
 
 // handleMarkdown serves a markdown file as HTML
 func (s *Server) handleMarkdown(w http.ResponseWriter, r *http.Request, filePath string) {
+	if !s.isValidPath(filePath) {
+		http.Error(w, "Invalid path", http.StatusForbidden)
+		return
+	}
 	log.Printf("markdown: %s", s.relPath(filePath))
 	if s.liveReload != nil {
 		s.liveReload.EnsureWatching(filepath.Dir(filePath))
 	}
-	// Read markdown file
-	content, err := os.ReadFile(filePath)
+	data, err := s.markdownPageData(filePath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusNotFound)
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to render markdown: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
 
-	// Render markdown to HTML
-	htmlContent, err := renderer.RenderMarkdown(content)
+	// Load and execute template
+	tmpl, err := s.loadTemplate("page.html")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to render markdown: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to load template: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Extract title from first h1 or use filename
-	title := extractTitle(string(content), filepath.Base(filePath))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// pageData is the template data for page.html
+type pageData struct {
+	Title       string
+	Meta        map[string]any
+	Content     template.HTML
+	TOC         []*renderer.TOCEntry // Headings, nested by level
+	Breadcrumbs []Breadcrumb
+	Backlinks   []Backlink // Pages linking to this one
+	Libs        libraryURLs
+	Theme       string
+	Static      bool // Set when exporting a static site; hides server-only controls
+}
+
+// libraryURLs are where pages load the client libraries from
+type libraryURLs struct {
+	MermaidJS string
+	KaTeXCSS  string
+	KaTeXJS   string
+}
+
+// pageLibraries are the URLs of the pinned libraries under /assets/vendor/
+var pageLibraries = libraryURLs{
+	MermaidJS: "/assets/vendor/" + libs.MermaidJS,
+	KaTeXCSS:  "/assets/vendor/" + libs.KaTeXCSS,
+	KaTeXJS:   "/assets/vendor/" + libs.KaTeXJS,
+}
+
+// markdownPageData renders a markdown file and builds its page template data
+func (s *Server) markdownPageData(filePath string) (pageData, error) {
+	page, err := s.renderPage(filePath)
+	if err != nil {
+		return pageData{}, err
+	}
 
 	// Calculate relative path from root directory for breadcrumbs
 	relPath, err := filepath.Rel(s.config.RootDir, filePath)
@@ -52,32 +98,87 @@ func (s *Server) handleMarkdown(w http.ResponseWriter, r *http.Request, filePath
 		relPath = filepath.Base(filePath)
 	}
 
-	// Generate breadcrumbs
-	breadcrumbs := createBreadcrumbs(relPath)
+	return pageData{
+		Title:       page.Title,
+		Meta:        page.Meta,
+		Content:     template.HTML(page.HTML),
+		TOC:         page.TOC,
+		Breadcrumbs: createBreadcrumbs(relPath),
+		Backlinks:   s.links.Backlinks(filePath),
+		Libs:        pageLibraries,
+		Theme:       s.currentTheme(),
+	}, nil
+}
 
-	// Load and execute template
-	tmpl, err := s.loadTemplate()
+// renderContent renders a markdown file's title, body and table of contents
+// for in-place live reload
+func (s *Server) renderContent(filePath string) (renderedContent, error) {
+	page, err := s.renderPage(filePath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to load template: %v", err), http.StatusInternalServerError)
-		return
+		return renderedContent{}, err
 	}
+	return renderedContent{
+		Title: page.Title,
+		HTML:  page.HTML,
+		TOC:   renderer.TOCHTML(page.TOC),
+	}, nil
+}
 
-	data := struct {
-		Title       string
-		Content     template.HTML
-		Breadcrumbs []Breadcrumb
-	}{
-		Title:       title,
-		Content:     template.HTML(htmlContent),
-		Breadcrumbs: breadcrumbs,
+// renderedPage is the cached result of rendering a markdown file
+type renderedPage struct {
+	HTML  []byte
+	Meta  map[string]any
+	Title string
+	TOC   []*renderer.TOCEntry
+}
+
+// renderPage renders the markdown file at filePath, reusing the cached result
+// while the file's modification time and size are unchanged
+func (s *Server) renderPage(filePath string) (renderedPage, error) {
+	return s.renderPageWith(filePath, s.pageCache.get)
+}
+
+// renderPageWith is renderPage with a custom cache lookup. Renders for other
+// pages, such as the link graph's, use pageCache.peek to stay out of the
+// request statistics.
+func (s *Server) renderPageWith(filePath string, lookup func(string, os.FileInfo) (renderedPage, bool)) (renderedPage, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return renderedPage{}, err
+	}
+	if page, ok := lookup(filePath, info); ok {
+		return page, nil
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := tmpl.Execute(w, data); err != nil {
-		log.Printf("Template execution error: %v", err)
-		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-		return
+	// Read markdown file
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return renderedPage{}, err
+	}
+
+	// Render markdown to HTML
+	doc, err := renderer.RenderWithOptions(content, renderer.Options{
+		WikiResolver:     s.wiki.Resolver(filePath),
+		DisableMath:      s.config.DisableMath,
+		DisableWikiLinks: s.config.DisableWikiLinks,
+		DisableTOC:       s.config.DisableTOC,
+	})
+	if err != nil {
+		return renderedPage{}, err
+	}
+
+	page := renderedPage{
+		HTML:  doc.HTML,
+		Meta:  doc.Meta,
+		Title: doc.Title,
+		TOC:   doc.TOC,
 	}
+	// Use the filename when there is no front matter title or h1
+	if page.Title == "" {
+		page.Title = strings.TrimSuffix(filepath.Base(filePath), ".md")
+	}
+	s.pageCache.put(filePath, info, page)
+	return page, nil
 }
 
 // DirectoryEntry represents a file or directory in a listing
@@ -94,13 +195,44 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request, dirPath str
 	if s.liveReload != nil {
 		s.liveReload.EnsureWatching(dirPath)
 	}
-	// Read directory entries
-	entries, err := os.ReadDir(dirPath)
+	data, err := s.directoryPageData(dirPath)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to read directory: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// Load directory template
+	tmpl, err := s.loadTemplate("directory.html")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// directoryData is the template data for directory.html
+type directoryData struct {
+	Title       string
+	Breadcrumbs []Breadcrumb
+	Entries     []DirectoryEntry
+	Theme       string
+	Static      bool // Set when exporting a static site; hides server-only controls
+}
+
+// directoryPageData lists a directory and builds its listing template data
+func (s *Server) directoryPageData(dirPath string) (directoryData, error) {
+	// Read directory entries
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return directoryData{}, err
+	}
+
 	// Calculate relative path from root directory for breadcrumbs
 	relPath, err := filepath.Rel(s.config.RootDir, dirPath)
 	if err != nil {
@@ -125,31 +257,25 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request, dirPath str
 	isAtRoot := absDirPath == absRootDir
 
 	for _, entry := range entries {
-		// Skip hidden files/directories
-		if strings.HasPrefix(entry.Name(), ".") {
-			continue
-		}
-
 		// Only include directories or markdown files
 		isMarkdown := !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".md")
 		if !entry.IsDir() && !isMarkdown {
 			continue
 		}
 
+		// Skip hidden, ignored and denied files/directories
 		entryPath := filepath.Join(dirPath, entry.Name())
+		if s.ignore.Ignored(entryPath, entry.IsDir()) || !s.isValidPath(entryPath) {
+			continue
+		}
+
 		relEntryPath, err := filepath.Rel(s.config.RootDir, entryPath)
 		if err != nil {
 			continue
 		}
 
 		// Build URL path with proper encoding
-		relSlash := filepath.ToSlash(relEntryPath)
-		parts := strings.Split(relSlash, "/")
-		encodedParts := make([]string, len(parts))
-		for i, part := range parts {
-			encodedParts[i] = url.PathEscape(part)
-		}
-		urlPath := "/" + strings.Join(encodedParts, "/")
+		urlPath := urlFromRelPath(relEntryPath)
 		if entry.IsDir() {
 			urlPath += "/"
 		}
@@ -195,35 +321,32 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request, dirPath str
 		}
 	}
 
-	// Load directory template
-	tmpl, err := s.loadDirectoryTemplate()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to load template: %v", err), http.StatusInternalServerError)
-		return
-	}
-
 	// Determine title
 	title := "Index"
 	if relPath != "." && relPath != "" {
 		title = filepath.Base(dirPath)
 	}
 
-	data := struct {
-		Title       string
-		Breadcrumbs []Breadcrumb
-		Entries     []DirectoryEntry
-	}{
+	return directoryData{
 		Title:       title,
 		Breadcrumbs: breadcrumbs,
 		Entries:     dirEntries,
-	}
+		Theme:       s.currentTheme(),
+	}, nil
+}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := tmpl.Execute(w, data); err != nil {
-		log.Printf("Template execution error: %v", err)
-		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+// serveLibrary serves a bundled client library file. Builds without the
+// library files redirect to the CDN instead.
+func (s *Server) serveLibrary(w http.ResponseWriter, r *http.Request, path string) {
+	data, ok := libs.Read(path)
+	if !ok {
+		http.Redirect(w, r, libs.CDNURL(path), http.StatusFound)
 		return
 	}
+	w.Header().Set("Content-Type", getContentType(strings.ToLower(filepath.Ext(path))))
+	// Paths include the library version, so they never change
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Write(data)
 }
 
 // handleAssets serves static files (images, CSS, JS)
@@ -254,6 +377,12 @@ func (s *Server) handleAssets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Client libraries bundled in the binary
+	if libPath, ok := strings.CutPrefix(requestPath, "vendor/"); ok && libs.IsFile(libPath) {
+		s.serveLibrary(w, r, libPath)
+		return
+	}
+
 	// Construct full file path
 	filePath := filepath.Join(s.config.RootDir, requestPath)
 
@@ -281,100 +410,46 @@ func (s *Server) handleAssets(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, filePath)
 }
 
-// serveCSS serves the CSS file from template directory
+// serveCSS serves the stylesheet
 func (s *Server) serveCSS(w http.ResponseWriter, r *http.Request) {
-	// Try to find template directory relative to executable or current directory
-	exePath, err := os.Executable()
-	var cssPath string
-	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		cssPath = filepath.Join(exeDir, "template", "style.css")
-		if _, err := os.Stat(cssPath); os.IsNotExist(err) {
-			// Try relative to current working directory
-			cssPath = "template/style.css"
-		}
-	} else {
-		cssPath = "template/style.css"
-	}
-
-	// Check if file exists
-	if _, err := os.Stat(cssPath); os.IsNotExist(err) {
-		// Serve default CSS inline
-		log.Printf("file: %s (default CSS)", cssPath)
-		w.Header().Set("Content-Type", "text/css; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		w.Header().Set("Pragma", "no-cache")
-		w.Header().Set("Expires", "0")
-		w.Write([]byte(getDefaultCSS()))
-		return
-	}
-
-	log.Printf("file: %s", cssPath)
 	w.Header().Set("Content-Type", "text/css; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
-	http.ServeFile(w, r, cssPath)
+	w.Write(s.stylesheet())
 }
 
-// loadTemplate loads the HTML template
-func (s *Server) loadTemplate() (*template.Template, error) {
-	// Try to find template directory relative to executable or current directory
-	exePath, err := os.Executable()
-	var templatePath string
-	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		templatePath = filepath.Join(exeDir, "template", "page.html")
-		if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-			// Try relative to current working directory
-			templatePath = "template/page.html"
-		}
-	} else {
-		templatePath = "template/page.html"
-	}
-
-	// Try to load template file
-	tmplContent, err := os.ReadFile(templatePath)
+// stylesheet returns style.css followed by the stylesheet for the configured
+// code highlighting theme
+func (s *Server) stylesheet() []byte {
+	css, err := fs.ReadFile(s.templates, "style.css")
 	if err != nil {
-		// Use default template
-		return s.getDefaultTemplate()
-	}
-
-	tmplContentStr := string(tmplContent)
-	// Inject LiveReload script if enabled
-	if s.config.EnableLiveReload {
-		tmplContentStr = s.injectLiveReloadScript(tmplContentStr)
+		log.Printf("Failed to read style.css: %v", err)
 	}
 
-	tmpl, parseErr := template.New("page").Parse(tmplContentStr)
-	if parseErr != nil {
-		return nil, parseErr
+	highlightCSS, err := renderer.ThemedHighlightCSS(s.config.CodeTheme, s.config.DarkCodeTheme)
+	if err != nil {
+		log.Printf("Failed to generate code highlighting CSS: %v", err)
 	}
 
-	return tmpl, nil
+	css = append(css, "\n/* Code highlighting */\n"...)
+	return append(css, highlightCSS...)
 }
 
-// loadDirectoryTemplate loads the directory listing template
-func (s *Server) loadDirectoryTemplate() (*template.Template, error) {
-	// Try to find template directory relative to executable or current directory
-	exePath, err := os.Executable()
-	var templatePath string
-	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		templatePath = filepath.Join(exeDir, "template", "directory.html")
-		if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-			// Try relative to current working directory
-			templatePath = "template/directory.html"
-		}
-	} else {
-		templatePath = "template/directory.html"
+// loadTemplate parses the named template file, reusing the parsed template
+// while the file is unchanged
+func (s *Server) loadTemplate(file string) (*template.Template, error) {
+	info, err := fs.Stat(s.templates, file)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl, ok := s.templateCache.get(file, info); ok {
+		return tmpl, nil
 	}
 
-	// Try to load template file
-	tmplContent, err := os.ReadFile(templatePath)
+	tmplContent, err := fs.ReadFile(s.templates, file)
 	if err != nil {
-		// Use default directory template
-		return s.getDefaultDirectoryTemplate()
+		return nil, err
 	}
 
 	tmplContentStr := string(tmplContent)
@@ -383,97 +458,15 @@ func (s *Server) loadDirectoryTemplate() (*template.Template, error) {
 		tmplContentStr = s.injectLiveReloadScript(tmplContentStr)
 	}
 
-	tmpl, parseErr := template.New("directory").Parse(tmplContentStr)
-	if parseErr != nil {
-		return nil, parseErr
+	tmpl, err := template.New(file).Parse(tmplContentStr)
+	if err != nil {
+		return nil, err
 	}
 
+	s.templateCache.put(file, info, tmpl)
 	return tmpl, nil
 }
 
-// getDefaultTemplate returns a default HTML template
-func (s *Server) getDefaultTemplate() (*template.Template, error) {
-	tmpl := `<!DOCTYPE html>
-<html lang="en">
-<head>
-	<meta charset="UTF-8">
-	<meta name="viewport" content="width=device-width, initial-scale=1.0">
-	<title>{{.Title}}</title>
-	<link rel="icon" type="image/svg+xml" href="/favicon.ico">
-	<link rel="icon" type="image/svg+xml" href="/favicon.svg">
-	<link rel="apple-touch-icon" href="/favicon.ico">
-	<link rel="stylesheet" href="/assets/style.css">
-	<script src="https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.min.js"></script>
-</head>
-<body>
-	<div class="container">
-		{{if .Breadcrumbs}}
-		<nav class="breadcrumbs">
-			<span class="breadcrumb-links">
-				{{range $index, $crumb := .Breadcrumbs}}{{if $index}}    {{end}}<a href="{{$crumb.Href}}">{{$crumb.Text}}</a>{{end}}
-			</span>
-			<a href="/settings" class="settings-icon" title="Settings">` + settingsGearIcon + `</a>
-		</nav>
-		{{end}}
-		{{.Content}}
-	</div>
-	<script>
-		mermaid.initialize({ startOnLoad: true, theme: 'default' });
-	</script>
-</body>
-</html>`
-
-	tmplStr := tmpl
-	// Inject LiveReload script if enabled
-	if s.config.EnableLiveReload {
-		tmplStr = s.injectLiveReloadScript(tmplStr)
-	}
-
-	return template.New("page").Parse(tmplStr)
-}
-
-// getDefaultDirectoryTemplate returns a default directory listing template
-func (s *Server) getDefaultDirectoryTemplate() (*template.Template, error) {
-	tmpl := `<!DOCTYPE html>
-<html lang="en">
-<head>
-	<meta charset="UTF-8">
-	<meta name="viewport" content="width=device-width, initial-scale=1.0">
-	<title>{{.Title}}</title>
-	<link rel="icon" type="image/svg+xml" href="/favicon.ico">
-	<link rel="icon" type="image/svg+xml" href="/favicon.svg">
-	<link rel="apple-touch-icon" href="/favicon.ico">
-	<link rel="stylesheet" href="/assets/style.css">
-</head>
-<body>
-	<div class="container">
-		<nav class="breadcrumbs">
-			<span class="breadcrumb-links">
-				{{range $index, $crumb := .Breadcrumbs}}{{if $index}}    {{end}}<a href="{{$crumb.Href}}">{{$crumb.Text}}</a>{{end}}
-			</span>
-			<a href="/settings" class="settings-icon" title="Settings">` + settingsGearIcon + `</a>
-		</nav>
-		<h1>{{.Title}}</h1>
-		<ul class="directory-listing">
-			{{range .Entries}}
-			<li class="{{if .IsDir}}directory{{else if .IsMarkdown}}markdown{{else}}file{{end}}">
-				<a href="{{.Path}}">{{.Name}}{{if .IsDir}}/{{end}}</a>
-			</li>
-			{{end}}
-		</ul>
-	</div>
-</body>
-</html>`
-
-	tmplStr := tmpl
-	// Inject LiveReload script if enabled
-	if s.config.EnableLiveReload {
-		tmplStr = s.injectLiveReloadScript(tmplStr)
-	}
-
-	return template.New("directory").Parse(tmplStr)
-}
-
 // WatchedDir represents a watched directory for the settings page.
 type WatchedDir struct {
 	Path    string
@@ -516,22 +509,76 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	tmpl, err := s.loadSettingsTemplate()
+	tmpl, err := s.loadTemplate("settings.html")
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to load template: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	data := struct {
-		Title              string
-		Breadcrumbs        []Breadcrumb
-		WatchedDirs        []WatchedDir
-		LiveReloadEnabled  bool
+		Title             string
+		Breadcrumbs       []Breadcrumb
+		WatchedDirs       []WatchedDir
+		LiveReloadEnabled bool
+		RenderCache       CacheStats
+		Theme             string
+		Themes            []string
+		CSRFToken         string
 	}{
 		Title:             "Settings",
 		Breadcrumbs:       breadcrumbs,
 		WatchedDirs:       watchedDirs,
 		LiveReloadEnabled: liveReloadEnabled,
+		RenderCache:       s.pageCache.stats(),
+		Theme:             s.currentTheme(),
+		Themes:            renderer.Themes(),
+		CSRFToken:         s.csrfToken,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// handleSearch renders full-text search results for the q query parameter.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	log.Printf("search: %q", query)
+
+	breadcrumbs := []Breadcrumb{
+		{Href: "/", Text: template.HTML(`<svg width="16" height="16" viewBox="0 0 16 16" fill="currentColor" style="vertical-align: middle; display: inline-block;"><path d="M8 0L0 7h2v9h5v-6h2v6h5V7h2L8 0z"/></svg>/`)},
+		{Href: "/search", Text: "Search"},
+	}
+
+	tmpl, err := s.loadTemplate("search.html")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	title := "Search"
+	if query != "" {
+		title = "Search: " + query
+	}
+
+	data := struct {
+		Title       string
+		Breadcrumbs []Breadcrumb
+		Query       string
+		Results     []SearchResult
+		Theme       string
+	}{
+		Title:       title,
+		Breadcrumbs: breadcrumbs,
+		Query:       query,
+		Results:     s.search.Search(query),
+		Theme:       s.currentTheme(),
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -553,10 +600,8 @@ func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
 		f.Flush()
 	}
 
-	go func() {
-		time.Sleep(100 * time.Millisecond)
-		os.Exit(0)
-	}()
+	// Start waits for this response to finish before it returns
+	s.requestShutdown()
 }
 
 // handleRemoveWatch removes a watched directory.
@@ -588,101 +633,22 @@ func (s *Server) handleRemoveWatch(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
 
-// loadSettingsTemplate loads the settings page template.
-func (s *Server) loadSettingsTemplate() (*template.Template, error) {
-	exePath, err := os.Executable()
-	var templatePath string
-	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		templatePath = filepath.Join(exeDir, "template", "settings.html")
-		if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-			templatePath = "template/settings.html"
-		}
-	} else {
-		templatePath = "template/settings.html"
-	}
-
-	tmplContent, err := os.ReadFile(templatePath)
-	if err != nil {
-		return s.getDefaultSettingsTemplate()
-	}
-
-	tmplContentStr := string(tmplContent)
-	if s.config.EnableLiveReload {
-		tmplContentStr = s.injectLiveReloadScript(tmplContentStr)
+// handleTheme changes the page theme from the settings page
+func (s *Server) handleTheme(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	return template.New("settings").Parse(tmplContentStr)
-}
-
-// getDefaultSettingsTemplate returns a default settings page template.
-func (s *Server) getDefaultSettingsTemplate() (*template.Template, error) {
-	tmpl := `<!DOCTYPE html>
-<html lang="en">
-<head>
-	<meta charset="UTF-8">
-	<meta name="viewport" content="width=device-width, initial-scale=1.0">
-	<title>{{.Title}}</title>
-	<link rel="icon" type="image/svg+xml" href="/favicon.ico">
-	<link rel="icon" type="image/svg+xml" href="/favicon.svg">
-	<link rel="apple-touch-icon" href="/favicon.ico">
-	<link rel="stylesheet" href="/assets/style.css">
-</head>
-<body>
-	<div class="container">
-		<nav class="breadcrumbs">
-			<span class="breadcrumb-links">
-				{{range $index, $crumb := .Breadcrumbs}}{{if $index}}    {{end}}<a href="{{$crumb.Href}}">{{$crumb.Text}}</a>{{end}}
-			</span>
-		</nav>
-		<h1>Settings</h1>
-		<div class="settings-section">
-			<h2>Server</h2>
-			<form method="POST" action="/settings/shutdown" onsubmit="return confirm('Are you sure you want to shut down the server?');">
-				<button type="submit" class="shutdown-btn">` + `<svg width="16" height="16" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round"><path d="M18.36 6.64a9 9 0 1 1-12.73 0"></path><line x1="12" y1="2" x2="12" y2="12"></line></svg>` + ` Shut Down Server</button>
-			</form>
-		</div>
-		{{if .LiveReloadEnabled}}
-		<div class="settings-section">
-			<h2>Watched Directories</h2>
-			<div class="watched-dirs-list">
-				{{range .WatchedDirs}}
-				<div class="watched-dir-row">
-					<span class="watched-dir-path">{{.Display}}</span>
-					{{if .IsRoot}}<span class="root-badge">root</span>{{else}}
-					<form method="POST" action="/settings/remove-watch" style="display:inline;">
-						<input type="hidden" name="dir" value="{{.Path}}">
-						<button type="submit" class="remove-watch-btn">Remove</button>
-					</form>
-					{{end}}
-				</div>
-				{{end}}
-			</div>
-		</div>
-		{{end}}
-	</div>
-</body>
-</html>`
-
-	tmplStr := tmpl
-	if s.config.EnableLiveReload {
-		tmplStr = s.injectLiveReloadScript(tmplStr)
+	theme := r.FormValue("theme")
+	if !renderer.IsTheme(theme) {
+		http.Error(w, "Unknown theme", http.StatusBadRequest)
+		return
 	}
 
-	return template.New("settings").Parse(tmplStr)
-}
-
-// extractTitle extracts title from markdown content or uses filename
-func extractTitle(content, filename string) string {
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "# ") {
-			return strings.TrimPrefix(line, "# ")
-		}
-	}
-	// Remove .md extension from filename
-	return strings.TrimSuffix(filename, ".md")
+	s.setTheme(theme)
+	log.Printf("theme: %s", theme)
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
 
 // createBreadcrumbs generates breadcrumb navigation from a relative path
@@ -746,13 +712,7 @@ func createBreadcrumbs(relPath string) []Breadcrumb {
 		displayName := strings.TrimSuffix(filename, ".md")
 
 		// Build the full URL path for the file
-		relSlash := filepath.ToSlash(relPath)
-		parts := strings.Split(relSlash, "/")
-		encodedParts := make([]string, len(parts))
-		for i, part := range parts {
-			encodedParts[i] = url.PathEscape(part)
-		}
-		fileURL := "/" + strings.Join(encodedParts, "/")
+		fileURL := urlFromRelPath(relPath)
 
 		crumbs = append(crumbs, Breadcrumb{
 			Href: fileURL,
@@ -763,17 +723,176 @@ func createBreadcrumbs(relPath string) []Breadcrumb {
 	return crumbs
 }
 
+// urlFromRelPath builds an escaped, absolute URL path from a path relative to the root directory
+func urlFromRelPath(relPath string) string {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	encodedParts := make([]string, len(parts))
+	for i, part := range parts {
+		encodedParts[i] = url.PathEscape(part)
+	}
+	return "/" + strings.Join(encodedParts, "/")
+}
+
 // injectLiveReloadScript injects the LiveReload client script into HTML templates
 func (s *Server) injectLiveReloadScript(html string) string {
 	script := `<script>
 (function() {
+	// Remember each mermaid diagram's source before mermaid replaces it with
+	// an SVG, so unchanged diagrams can be kept when the page is patched
+	function rememberMermaidSources(root) {
+		root.querySelectorAll('.mermaid').forEach(function(el) {
+			if (el.dataset.source === undefined) {
+				el.dataset.source = el.textContent;
+			}
+		});
+	}
+
+	// scrollAnchor returns the last heading above the top of the viewport and
+	// its offset, or the scroll position if there is none
+	function scrollAnchor(content) {
+		var anchor = null;
+		content.querySelectorAll('h1[id], h2[id], h3[id], h4[id], h5[id], h6[id]').forEach(function(h) {
+			if (h.getBoundingClientRect().top <= 1) {
+				anchor = h;
+			}
+		});
+		if (!anchor) {
+			return {id: null, offset: window.scrollY};
+		}
+		return {id: anchor.id, offset: anchor.getBoundingClientRect().top};
+	}
+
+	function restoreScroll(anchor) {
+		var el = anchor.id && document.getElementById(anchor.id);
+		if (el) {
+			window.scrollBy(0, el.getBoundingClientRect().top - anchor.offset);
+		} else {
+			window.scrollTo(0, anchor.offset);
+		}
+	}
+
+	// patch swaps newly rendered content into the page in place
+	function patch(msg) {
+		var content = document.getElementById('content');
+		var toc = document.getElementById('toc');
+		// The sidebar changes the page layout, so adding or removing it needs a reload
+		if (!content || !toc !== !msg.toc) {
+			window.location.reload();
+			return;
+		}
+		var anchor = scrollAnchor(content);
+
+		var next = document.createElement('div');
+		next.innerHTML = msg.html;
+
+		// Reuse rendered diagrams whose source hasn't changed
+		var rendered = {};
+		content.querySelectorAll('.mermaid').forEach(function(el) {
+			var source = el.dataset.source;
+			(rendered[source] = rendered[source] || []).push(el);
+		});
+		var changed = [];
+		next.querySelectorAll('.mermaid').forEach(function(el) {
+			var source = el.textContent;
+			var old = rendered[source] && rendered[source].shift();
+			if (old) {
+				el.replaceWith(old);
+			} else {
+				el.dataset.source = source;
+				changed.push(el);
+			}
+		});
+
+		content.replaceChildren.apply(content, Array.from(next.childNodes));
+		if (toc) {
+			toc.innerHTML = msg.toc;
+		}
+		if (msg.title) {
+			document.title = msg.title;
+		}
+		if (window.renderMath) {
+			renderMath(content);
+		}
+		restoreScroll(anchor);
+
+		if (changed.length && window.mermaid) {
+			mermaid.run({nodes: changed}).then(function() {
+				restoreScroll(anchor);
+			});
+		}
+	}
+
+	// servedPath returns the decoded path of a same-origin URL, with the
+	// /assets/ prefix removed since it maps to the root directory too
+	function servedPath(url) {
+		var u = new URL(url, window.location.href);
+		if (u.host !== window.location.host) {
+			return null;
+		}
+		var path = decodeURIComponent(u.pathname);
+		return path.indexOf('/assets/') === 0 ? path.slice('/assets'.length) : path;
+	}
+
+	function cacheBust(url) {
+		var u = new URL(url, window.location.href);
+		u.searchParams.set('livereload', Date.now());
+		return u.toString();
+	}
+
+	// refreshAsset updates whatever on the page uses a changed file: stylesheets
+	// are swapped without a reload, images are refetched, and anything else the
+	// page loads (scripts, media) reloads the page
+	function refreshAsset(path) {
+		path = decodeURIComponent(path);
+		document.querySelectorAll('link[rel="stylesheet"][href]').forEach(function(link) {
+			if (servedPath(link.href) !== path) {
+				return;
+			}
+			// Keep the old stylesheet until the new one loads to avoid a flash
+			var next = link.cloneNode();
+			next.href = cacheBust(link.href);
+			next.onload = next.onerror = function() {
+				link.remove();
+			};
+			link.after(next);
+		});
+		document.querySelectorAll('img[src]').forEach(function(img) {
+			if (servedPath(img.src) === path) {
+				img.src = cacheBust(img.src);
+			}
+		});
+		var others = document.querySelectorAll('script[src], video[src], audio[src], source[src], iframe[src], embed[src], object[data]');
+		for (var i = 0; i < others.length; i++) {
+			var url = others[i].getAttribute('src') || others[i].getAttribute('data');
+			if (servedPath(url) === path) {
+				window.location.reload();
+				return;
+			}
+		}
+	}
+
 	function connect() {
 		var protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
 		var host = window.location.host;
 		var ws = new WebSocket(protocol + '//' + host + '/livereload');
 
+		ws.onopen = function() {
+			// Register this page so only changes that affect it trigger a reload
+			ws.send(JSON.stringify({type: 'register', path: window.location.pathname}));
+		};
+
 		ws.onmessage = function(event) {
-			if (event.data === 'reload') {
+			var msg;
+			try {
+				msg = JSON.parse(event.data);
+			} catch (e) {
+				return;
+			}
+			if (msg.type === 'patch') {
+				patch(msg);
+			} else if (msg.type === 'asset') {
+				refreshAsset(msg.path);
+			} else if (msg.type === 'reload') {
 				window.location.reload();
 			}
 		};
@@ -788,6 +907,7 @@ func (s *Server) injectLiveReloadScript(html string) string {
 		};
 	}
 
+	rememberMermaidSources(document);
 	connect();
 })();
 </script>`
@@ -799,14 +919,3 @@ func (s *Server) injectLiveReloadScript(html string) string {
 	// If no </body> tag, append at the end
 	return html + script
 }
-
-// getDefaultCSS returns default CSS content
-func getDefaultCSS() string {
-	return `/* Default CSS - template/style.css not found */
-body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; max-width: 900px; margin: 0 auto; padding: 20px; line-height: 1.6; }
-code { background: #f5f5f5; padding: 2px 6px; border-radius: 3px; }
-pre { background: #f5f5f5; padding: 16px; border-radius: 5px; overflow-x: auto; }
-table { border-collapse: collapse; width: 100%; }
-th, td { border: 1px solid #ddd; padding: 8px 12px; }
-th { background: #f8f8f8; }`
-}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ignoreFiles are read in every directory, in this order, for ignore patterns
+var ignoreFiles = []string{".gitignore", ".mdserverignore"}
+
+// defaultIgnorePatterns hide dotfiles. Ignore files can re-include them with
+// negated patterns.
+var defaultIgnorePatterns = []string{
+	".*",
+}
+
+// ignoreRule is a single compiled gitignore pattern
+type ignoreRule struct {
+	base    string // Directory of the ignore file, relative to the root ("" for the root)
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreMatcher decides which files under a root directory are ignored, using
+// .gitignore and .mdserverignore files with gitignore semantics: patterns in
+// deeper directories take precedence, the last matching pattern wins, "!"
+// re-includes, and nothing inside an ignored directory can be re-included.
+type IgnoreMatcher struct {
+	rootDir string
+	root    []ignoreRule // Default and configured patterns
+
+	mu    sync.Mutex
+	rules map[string][]ignoreRule // Directory (relative) -> rules from its ignore files
+}
+
+// NewIgnoreMatcher creates a matcher for rootDir. patterns are applied as if
+// they were appended to the root .mdserverignore.
+func NewIgnoreMatcher(rootDir string, patterns []string) *IgnoreMatcher {
+	if abs, err := filepath.Abs(rootDir); err == nil {
+		rootDir = abs
+	}
+	m := &IgnoreMatcher{
+		rootDir: rootDir,
+		rules:   make(map[string][]ignoreRule),
+	}
+	m.root = compileIgnoreRules("", defaultIgnorePatterns)
+	m.root = append(m.root, compileIgnoreRules("", patterns)...)
+	return m
+}
+
+// Ignored reports whether the file at path is ignored, either itself or
+// because one of its parent directories is. The root directory and paths
+// outside it are never ignored.
+func (m *IgnoreMatcher) Ignored(path string, isDir bool) bool {
+	rel, ok := m.relPath(path)
+	if !ok || rel == "" {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// match applies the rules of every directory above rel to rel itself
+func (m *IgnoreMatcher) match(rel string, isDir bool) bool {
+	// Collect rules from the root down, so later (deeper) rules win
+	rules := m.dirRules("")
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' {
+			rules = append(rules, m.dirRules(rel[:i])...)
+		}
+	}
+
+	return matchRules(rules, rel, isDir)
+}
+
+// matchRules reports whether the last of rules that matches rel ignores it
+func matchRules(rules []ignoreRule, rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if rule.base != "" {
+			target = strings.TrimPrefix(rel, rule.base+"/")
+		}
+		if rule.re.MatchString(target) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// dirRules returns the rules that apply from directory dir, loading its ignore
+// files the first time it is seen. The returned slice must not be modified.
+func (m *IgnoreMatcher) dirRules(dir string) []ignoreRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules, ok := m.rules[dir]
+	if !ok {
+		if dir == "" {
+			rules = append(rules, m.root[:len(defaultIgnorePatterns)]...)
+		}
+		for _, name := range ignoreFiles {
+			data, err := os.ReadFile(filepath.Join(m.rootDir, filepath.FromSlash(dir), name))
+			if err != nil {
+				continue
+			}
+			rules = append(rules, compileIgnoreRules(dir, parseIgnoreFile(data))...)
+		}
+		if dir == "" {
+			rules = append(rules, m.root[len(defaultIgnorePatterns):]...)
+		}
+		m.rules[dir] = rules
+	}
+	return rules[:len(rules):len(rules)]
+}
+
+// FileChanged drops cached rules when an ignore file is written or removed,
+// so they are re-read on next use. It reports whether path is an ignore file.
+func (m *IgnoreMatcher) FileChanged(path string) bool {
+	if !isIgnoreFile(filepath.Base(path)) {
+		return false
+	}
+	dir, ok := m.relPath(filepath.Dir(path))
+	if !ok {
+		return true
+	}
+	m.mu.Lock()
+	delete(m.rules, dir)
+	m.mu.Unlock()
+	return true
+}
+
+// relPath returns path relative to the root with forward slashes, "" for the
+// root itself. ok is false for paths outside the root.
+func (m *IgnoreMatcher) relPath(path string) (rel string, ok bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	return relInside(m.rootDir, abs)
+}
+
+// isIgnoreFile reports whether name is the name of an ignore file
+func isIgnoreFile(name string) bool {
+	for _, f := range ignoreFiles {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIgnoreFile returns the patterns in an ignore file, without comments and blank lines
+func parseIgnoreFile(data []byte) []string {
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// compileIgnoreRules compiles gitignore patterns from an ignore file in base.
+// Invalid patterns are skipped.
+func compileIgnoreRules(base string, patterns []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, pattern := range patterns {
+		if rule, ok := compileIgnoreRule(base, pattern); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// compileIgnoreRule converts a gitignore pattern to a regular expression that
+// matches paths relative to base
+func compileIgnoreRule(base, pattern string) (ignoreRule, bool) {
+	rule := ignoreRule{base: base}
+
+	pattern = trimIgnoreTrailingSpace(pattern)
+	if strings.HasPrefix(pattern, "#") {
+		return rule, false
+	}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return rule, false
+	}
+
+	// A slash anywhere but the end anchors the pattern to the ignore file's
+	// directory; otherwise it matches a name at any depth
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			re.WriteString("(?:.*/)?") // Zero or more directories
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && (i == 0 || pattern[i-1] == '/') && i+2 == len(pattern):
+			re.WriteString(".*") // Everything inside
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return rule, false
+	}
+	rule.re = compiled
+	return rule, true
+}
+
+// trimIgnoreTrailingSpace removes trailing spaces unless they are escaped with a backslash
+func trimIgnoreTrailingSpace(pattern string) string {
+	for strings.HasSuffix(pattern, " ") && !strings.HasSuffix(pattern, `\ `) {
+		pattern = pattern[:len(pattern)-1]
+	}
+	if strings.HasSuffix(pattern, `\ `) {
+		pattern = pattern[:len(pattern)-2] + " "
+	}
+	return pattern
+}
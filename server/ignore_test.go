@@ -0,0 +1,166 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, rootDir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(rootDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFiles(t, rootDir, map[string]string{
+		".gitignore":             "# build output\n/build/\n*.log\ndocs/generated/\n**/tmp/**\n!important.log\nvendor/\n!vendor/\n",
+		".mdserverignore":        "drafts/\n!.github/\nnotes/**/private.md\ndebug?.md\ndraft[0-9].md\n",
+		"docs/.gitignore":        "api.md\n/local.md\n",
+		"docs/sub/.gitignore":    "!api.md\n",
+		"drafts/.mdserverignore": "!*.md\n",
+	})
+	m := NewIgnoreMatcher(rootDir, []string{"*.bak", "!keep.bak"})
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"README.md", false, false},
+		{".hidden.md", false, true},
+		{".git", true, true},
+		{".github", true, false},      // Default re-included by a negation
+		{"node_modules", true, false}, // Only skipped by the watcher
+		{"vendor", true, false},       // Ignored and re-included by .gitignore
+		{"build", true, true},         // Anchored
+		{"docs/build", true, false},   // Anchored to the root only
+		{"docs/build/x.md", false, false},
+		{"build/x.md", false, true}, // Inside an ignored directory
+		{"server.log", false, true},
+		{"docs/deep/server.log", false, true}, // Unanchored matches at any depth
+		{"important.log", false, false},       // Negated
+		{"docs/generated", true, true},        // Middle slash anchors
+		{"x/docs/generated", true, false},
+		{"a/tmp/b/c.md", false, true}, // Leading and trailing **
+		{"a/tmp", true, false},
+		{"notes/private.md", false, true}, // ** matches zero directories
+		{"notes/a/b/private.md", false, true},
+		{"other/private.md", false, false},
+		{"debug1.md", false, true},
+		{"debug10.md", false, false},
+		{"draft7.md", false, true},
+		{"draftx.md", false, false},
+		{"docs/api.md", false, true},      // Nested ignore file
+		{"docs/sub/api.md", false, false}, // Re-included deeper down
+		{"api.md", false, false},          // Nested rules don't apply above
+		{"docs/local.md", false, true},
+		{"docs/sub/local.md", false, false}, // Anchored to docs/
+		{"drafts/post.md", false, true},     // Can't re-include inside an ignored directory
+		{"old.bak", false, true},            // Configured patterns
+		{"keep.bak", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Ignored(filepath.Join(rootDir, tt.path), tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, dir=%t) = %t, want %t", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	if m.Ignored(rootDir, true) {
+		t.Error("Root directory should never be ignored")
+	}
+	if m.Ignored(filepath.Join(filepath.Dir(rootDir), "x.log"), false) {
+		t.Error("Paths outside the root should never be ignored")
+	}
+}
+
+func TestIgnoreMatcherFileChanged(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFiles(t, rootDir, map[string]string{".gitignore": "out/\n"})
+	m := NewIgnoreMatcher(rootDir, nil)
+	out := filepath.Join(rootDir, "out")
+	if !m.Ignored(out, true) {
+		t.Fatal("out/ should be ignored")
+	}
+
+	writeFiles(t, rootDir, map[string]string{".gitignore": "gen/\n"})
+	if !m.Ignored(out, true) {
+		t.Error("Rules should be cached until the ignore file is reported as changed")
+	}
+	if m.FileChanged(filepath.Join(rootDir, "notes.md")) {
+		t.Error("FileChanged(notes.md) = true, want false")
+	}
+	if !m.FileChanged(filepath.Join(rootDir, ".gitignore")) {
+		t.Error("FileChanged(.gitignore) = false, want true")
+	}
+	if m.Ignored(out, true) || !m.Ignored(filepath.Join(rootDir, "gen"), true) {
+		t.Error("Changed ignore file should be re-read")
+	}
+}
+
+func TestIgnoredFilesHidden(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFiles(t, rootDir, map[string]string{
+		".gitignore":        "build/\n",
+		".mdserverignore":   "secret*.md\n",
+		"README.md":         "# Home\n\nwidget\n",
+		"guide.md":          "# Guide\n\nwidget\n",
+		"secret-plans.md":   "# Secret\n\nwidget\n",
+		"build/output.md":   "# Output\n\nwidget\n",
+		"build/logo.png":    "png-bytes",
+		"docs/generated.md": "# Generated\n\nwidget\n",
+	})
+	srv := NewServer(Config{RootDir: rootDir, DisableFallback: true, IgnorePatterns: []string{"generated.md"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rr, req)
+	listing := rr.Body.String()
+	if !strings.Contains(listing, "guide.md") {
+		t.Errorf("Listing should include guide.md: %s", listing)
+	}
+	for _, hidden := range []string{"secret-plans.md", "build", ".gitignore"} {
+		if strings.Contains(listing, `href="/`+hidden) {
+			t.Errorf("Listing should not include %s", hidden)
+		}
+	}
+
+	results := srv.search.Search("widget")
+	if len(results) != 2 {
+		t.Errorf("Search returned %d results, want 2 (README.md and guide.md): %+v", len(results), results)
+	}
+
+	// Ignored files are still served when requested directly
+	req = httptest.NewRequest(http.MethodGet, "/secret-plans.md", nil)
+	rr = httptest.NewRecorder()
+	srv.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("GET /secret-plans.md status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	outDir := t.TempDir()
+	if _, err := srv.Export(outDir); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	for _, name := range []string{"index.html", "guide.html"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("Expected %s in export: %v", name, err)
+		}
+	}
+	for _, name := range []string{"secret-plans.html", "build", "docs/generated.html"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err == nil {
+			t.Errorf("Ignored %s should not be exported", name)
+		}
+	}
+}
@@ -1,27 +1,112 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/websocket"
 )
 
+// upgrader only accepts handshakes from pages with the server's own origin,
+// so other sites can't open a socket to it
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from any origin
+	CheckOrigin: sameOrigin,
+}
+
+// reloadMessage is sent to clients when a document they are viewing changes
+// ("reload") or when any other file changes ("asset"). Clients refresh the
+// stylesheets and images that reference an asset, and ignore the rest.
+type reloadMessage struct {
+	Type string `json:"type"`           // "reload" or "asset"
+	Path string `json:"path,omitempty"` // URL path of the changed file
+}
+
+// patchMessage carries the newly rendered content of a changed document to
+// clients viewing it, so they can update the page in place
+type patchMessage struct {
+	Type  string `json:"type"` // Always "patch"
+	Path  string `json:"path"` // URL path of the changed file
+	Title string `json:"title"`
+	HTML  string `json:"html"` // Rendered document body, as in page.html's .Content
+	TOC   string `json:"toc"`  // Table of contents list, as in page.html's sidebar
+}
+
+// renderedContent is a document rendered for a patch message
+type renderedContent struct {
+	Title string
+	HTML  []byte
+	TOC   []byte
+}
+
+// registerMessage is sent by clients to say which page they are viewing
+type registerMessage struct {
+	Type string `json:"type"` // Always "register"
+	Path string `json:"path"` // URL path of the page, as in location.pathname
+}
+
+// reloadEvent is a queued reload for a changed file
+type reloadEvent struct {
+	path    string // Absolute path of the changed file
+	message []byte
+	patch   []byte // Patch message for clients viewing the file itself, nil if unavailable
+	asset   []byte // Asset message for a changed non-markdown file, nil for documents
+	listing bool   // Whether listings of the file's directory need to reload
+}
+
+// messageFor returns the message to send to a client viewing page, or nil if
+// the event doesn't concern it
+func (e reloadEvent) messageFor(page clientPage) []byte {
+	if e.asset != nil {
+		// Clients that haven't registered only understand reload messages
+		if !page.registered {
+			return nil
+		}
+		if e.listing && page.isDir && filepath.Dir(e.path) == page.path {
+			return e.message
+		}
+		return e.asset
+	}
+	if !page.affectedBy(e.path) {
+		return nil
+	}
+	if e.patch != nil && page.registered && !page.isDir && page.path == e.path {
+		return e.patch
+	}
+	return e.message
+}
+
+// clientPage is the filesystem target of the page a client is viewing. A
+// client that hasn't registered receives every reload.
+type clientPage struct {
+	registered bool
+	path       string // Absolute path of the viewed file or directory, empty if none
+	isDir      bool
+}
+
+// affectedBy reports whether a change to path should reload the page. A
+// directory page (a listing, or its README/index fallback) is affected by any
+// change to its direct children.
+func (p clientPage) affectedBy(path string) bool {
+	if !p.registered {
 		return true
-	},
+	}
+	if p.isDir {
+		return filepath.Dir(path) == p.path
+	}
+	return path == p.path
 }
 
-// skipDirs are directories that should never be watched (heavy or irrelevant)
+// skipDirs are directories that should never be watched (heavy or irrelevant).
+// They are still listed, searched and exported unless ignore files hide them.
 var skipDirs = map[string]bool{
 	"node_modules": true,
 	"vendor":       true,
@@ -32,17 +117,25 @@ var skipDirs = map[string]bool{
 type LiveReload struct {
 	rootDir   string
 	verbose   bool
+	ignore    *IgnoreMatcher
 	watcher   *fsnotify.Watcher
-	clients   map[*websocket.Conn]bool
+	clients   map[*websocket.Conn]clientPage
 	clientsMu sync.RWMutex
 	watched   map[string]bool
 	watchedMu sync.Mutex
-	broadcast chan []byte
+	broadcast chan reloadEvent
 	stopChan  chan struct{}
+	stopOnce  sync.Once
+
+	listeners   []func(path string)
+	listenersMu sync.RWMutex
+
+	renderContent func(path string) (renderedContent, error)
 }
 
-// NewLiveReload creates a new LiveReload instance
-func NewLiveReload(rootDir string, verbose bool) (*LiveReload, error) {
+// NewLiveReload creates a new LiveReload instance. Directories and files
+// matched by ignore are not watched and don't trigger reloads.
+func NewLiveReload(rootDir string, ignore *IgnoreMatcher, verbose bool) (*LiveReload, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
@@ -51,10 +144,11 @@ func NewLiveReload(rootDir string, verbose bool) (*LiveReload, error) {
 	lr := &LiveReload{
 		rootDir:   rootDir,
 		verbose:   verbose,
+		ignore:    ignore,
 		watcher:   watcher,
-		clients:   make(map[*websocket.Conn]bool),
+		clients:   make(map[*websocket.Conn]clientPage),
 		watched:   make(map[string]bool),
-		broadcast: make(chan []byte, 256),
+		broadcast: make(chan reloadEvent, 256),
 		stopChan:  make(chan struct{}),
 	}
 
@@ -113,17 +207,11 @@ func (lr *LiveReload) watchDirectory(dir string, depth int) error {
 		}
 
 		if stat.IsDir() {
-			base := filepath.Base(entry)
-			// Skip hidden directories
-			if base[0] == '.' {
-				continue
-			}
-			// Skip known-heavy directories
-			if skipDirs[base] {
+			if lr.ignore.Ignored(entry, true) || skipDirs[filepath.Base(entry)] {
 				continue
 			}
 			if err := lr.watchDirectory(entry, depth-1); err != nil {
-				log.Printf("LiveReload: cannot watch %s: %v", base, err)
+				log.Printf("LiveReload: cannot watch %s: %v", filepath.Base(entry), err)
 			}
 		}
 	}
@@ -154,22 +242,33 @@ func (lr *LiveReload) watchFiles() {
 			if !ok {
 				return
 			}
-			isMarkdown := strings.EqualFold(filepath.Ext(event.Name), ".md")
-			shouldReload := isMarkdown && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0
+			changed := event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0
+			rulesChanged := changed && lr.ignore.FileChanged(event.Name)
+			if rulesChanged {
+				// Ignore files are usually ignored themselves, but listeners
+				// have to rebuild what the old rules hid or showed
+				lr.verbosef("LiveReload: ignore rules changed path=%s", event.Name)
+				lr.notifyChange(event.Name)
+			}
+			info, statErr := os.Stat(event.Name)
+			if lr.ignore.Ignored(event.Name, statErr == nil && info.IsDir()) {
+				lr.verbosef("LiveReload: ignored event path=%s op=%s", event.Name, event.Op.String())
+				continue
+			}
+			if changed && !rulesChanged {
+				lr.notifyChange(event.Name)
+			}
+			isMarkdown := isMarkdownFile(event.Name)
+			shouldReload := event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0
 			lr.verbosef("LiveReload: event path=%s op=%s markdown=%t reload=%t", event.Name, event.Op.String(), isMarkdown, shouldReload)
-			if shouldReload {
+			if shouldReload && isMarkdown {
 				lr.broadcastReload(event.Name, event.Op.String())
+			} else if shouldReload {
+				lr.broadcastAsset(event.Name, event.Op)
 			}
 			// Handle new directories being created
-			if event.Op&fsnotify.Create == fsnotify.Create {
-				// Check if it's a directory
-				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-					base := filepath.Base(event.Name)
-					// Skip hidden and heavy directories
-					if base[0] != '.' && !skipDirs[base] {
-						lr.watchDirectory(event.Name, 1)
-					}
-				}
+			if event.Op&fsnotify.Create == fsnotify.Create && statErr == nil && info.IsDir() && !skipDirs[filepath.Base(event.Name)] {
+				lr.watchDirectory(event.Name, 1)
 			}
 		case err, ok := <-lr.watcher.Errors:
 			if !ok {
@@ -182,14 +281,44 @@ func (lr *LiveReload) watchFiles() {
 	}
 }
 
-// broadcastMessages sends messages to all connected clients
+// OnChange registers fn to be called with the path of every file that is
+// written, created, renamed or removed, unless it is ignored, and of every
+// changed ignore file. Listeners run on the watcher goroutine
+// before any reload is broadcast, so they should return quickly.
+func (lr *LiveReload) OnChange(fn func(path string)) {
+	lr.listenersMu.Lock()
+	lr.listeners = append(lr.listeners, fn)
+	lr.listenersMu.Unlock()
+}
+
+// notifyChange calls all registered change listeners
+func (lr *LiveReload) notifyChange(path string) {
+	lr.listenersMu.RLock()
+	defer lr.listenersMu.RUnlock()
+	for _, fn := range lr.listeners {
+		fn(path)
+	}
+}
+
+// SetContentRenderer enables in-place updates: when a markdown file changes,
+// clients viewing it are sent the output of fn instead of a reload message.
+// Must be called before Start.
+func (lr *LiveReload) SetContentRenderer(fn func(path string) (renderedContent, error)) {
+	lr.renderContent = fn
+}
+
+// broadcastMessages sends reload messages to the clients viewing the changed file
 func (lr *LiveReload) broadcastMessages() {
 	for {
 		select {
-		case message := <-lr.broadcast:
-			lr.verbosef("LiveReload: broadcasting %q to %d clients", string(message), len(lr.clients))
+		case event := <-lr.broadcast:
 			lr.clientsMu.RLock()
-			for client := range lr.clients {
+			lr.verbosef("LiveReload: broadcasting %s to %d clients", event.message, len(lr.clients))
+			for client, page := range lr.clients {
+				message := event.messageFor(page)
+				if message == nil {
+					continue
+				}
 				err := client.WriteMessage(websocket.TextMessage, message)
 				if err != nil {
 					log.Printf("LiveReload: Error writing to client: %v", err)
@@ -210,7 +339,113 @@ func (lr *LiveReload) broadcastMessages() {
 
 func (lr *LiveReload) broadcastReload(path, op string) {
 	lr.verbosef("LiveReload: queue reload path=%s op=%s", path, op)
-	lr.broadcast <- []byte("reload")
+	msg := reloadMessage{Type: "reload", Path: lr.urlPath(path)}
+	message, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("LiveReload: Error encoding reload message: %v", err)
+		return
+	}
+	event := reloadEvent{
+		path:    filepath.Clean(path),
+		message: message,
+		patch:   lr.patchMessage(path, msg.Path),
+	}
+	select {
+	case lr.broadcast <- event:
+	case <-lr.stopChan:
+	}
+}
+
+// broadcastAsset queues an update for a changed non-markdown file. Every page
+// is told about it, since any document may reference the file; listings of its
+// directory reload when a file is added or moved away.
+func (lr *LiveReload) broadcastAsset(path string, op fsnotify.Op) {
+	lr.verbosef("LiveReload: queue asset path=%s op=%s", path, op.String())
+	urlPath := lr.urlPath(path)
+	asset, err := json.Marshal(reloadMessage{Type: "asset", Path: urlPath})
+	if err != nil {
+		log.Printf("LiveReload: Error encoding asset message: %v", err)
+		return
+	}
+	event := reloadEvent{path: filepath.Clean(path), asset: asset}
+	if op&(fsnotify.Create|fsnotify.Rename) != 0 {
+		event.listing = true
+		event.message, _ = json.Marshal(reloadMessage{Type: "reload", Path: urlPath})
+	}
+	select {
+	case lr.broadcast <- event:
+	case <-lr.stopChan:
+	}
+}
+
+// urlPath returns the URL path under which a file in the root directory is served
+func (lr *LiveReload) urlPath(path string) string {
+	rel, err := filepath.Rel(lr.rootDir, path)
+	if err != nil {
+		return ""
+	}
+	return urlFromRelPath(rel)
+}
+
+// patchMessage renders the changed file for clients that update in place.
+// It returns nil when in-place updates are disabled or the file can't be
+// rendered (for example, when it was renamed away), so clients reload instead.
+func (lr *LiveReload) patchMessage(path, urlPath string) []byte {
+	if lr.renderContent == nil || !isMarkdownFile(path) {
+		return nil
+	}
+	content, err := lr.renderContent(path)
+	if err != nil {
+		lr.verbosef("LiveReload: cannot render %s for patch: %v", path, err)
+		return nil
+	}
+	patch, err := json.Marshal(patchMessage{
+		Type:  "patch",
+		Path:  urlPath,
+		Title: content.Title,
+		HTML:  string(content.HTML),
+		TOC:   string(content.TOC),
+	})
+	if err != nil {
+		return nil
+	}
+	return patch
+}
+
+// resolvePage maps the URL path of a page to the file or directory it shows,
+// following the same rules as the request handler: directories, .md files,
+// and extensionless paths that name a .md file. ok is false for pages that
+// don't show anything on disk, such as settings and search.
+func (lr *LiveReload) resolvePage(urlPath string) (page clientPage, ok bool) {
+	decoded, err := url.PathUnescape(urlPath)
+	if err != nil {
+		return clientPage{}, false
+	}
+	path := filepath.Join(lr.rootDir, filepath.FromSlash(filepath.Clean("/"+decoded)))
+
+	if info, err := os.Stat(path); err == nil {
+		return clientPage{path: path, isDir: info.IsDir()}, true
+	}
+	if filepath.Ext(path) == "" {
+		if info, err := os.Stat(path + ".md"); err == nil && !info.IsDir() {
+			return clientPage{path: path + ".md"}, true
+		}
+	}
+	return clientPage{}, false
+}
+
+// register records the page a client is viewing. Pages that don't map to
+// anything on disk are never reloaded.
+func (lr *LiveReload) register(conn *websocket.Conn, urlPath string) {
+	page, _ := lr.resolvePage(urlPath)
+	page.registered = true
+	lr.verbosef("LiveReload: client registered path=%s target=%s", urlPath, page.path)
+
+	lr.clientsMu.Lock()
+	if _, connected := lr.clients[conn]; connected {
+		lr.clients[conn] = page
+	}
+	lr.clientsMu.Unlock()
 }
 
 func (lr *LiveReload) verbosef(format string, args ...any) {
@@ -227,9 +462,9 @@ func (lr *LiveReload) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add client to the map
+	// Add client to the map; it receives every reload until it registers a page
 	lr.clientsMu.Lock()
-	lr.clients[conn] = true
+	lr.clients[conn] = clientPage{}
 	lr.clientsMu.Unlock()
 
 	// log.Printf("LiveReload: Client connected (total: %d)", len(lr.clients))
@@ -244,12 +479,17 @@ func (lr *LiveReload) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			// log.Printf("LiveReload: Client disconnected (total: %d)", len(lr.clients))
 		}()
 
-		// Read loop to detect disconnection
+		// Read page registrations until the client disconnects
 		for {
-			_, _, err := conn.ReadMessage()
+			_, data, err := conn.ReadMessage()
 			if err != nil {
 				break
 			}
+			var msg registerMessage
+			if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "register" {
+				continue
+			}
+			lr.register(conn, msg.Path)
 		}
 	}()
 }
@@ -283,17 +523,27 @@ func (lr *LiveReload) RemoveWatch(dir string) error {
 	return nil
 }
 
-// Stop stops the file watcher and closes all connections
-func (lr *LiveReload) Stop() {
-	close(lr.stopChan)
-	lr.watcher.Close()
+// CloseClients sends every client a close frame saying the server is going
+// away, and closes its connection
+func (lr *LiveReload) CloseClients() {
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(time.Second)
 
 	lr.clientsMu.Lock()
 	for client := range lr.clients {
+		client.WriteControl(websocket.CloseMessage, message, deadline)
 		client.Close()
 	}
-	lr.clients = make(map[*websocket.Conn]bool)
+	lr.clients = make(map[*websocket.Conn]clientPage)
 	lr.clientsMu.Unlock()
+}
 
-	log.Println("LiveReload: Stopped")
+// Stop stops the file watcher and closes all connections. Calling it again does nothing.
+func (lr *LiveReload) Stop() {
+	lr.stopOnce.Do(func() {
+		close(lr.stopChan)
+		lr.watcher.Close()
+		lr.CloseClients()
+		log.Println("LiveReload: Stopped")
+	})
 }
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"net"
 	"net/http"
@@ -24,6 +26,18 @@ func findAvailablePort() (int, error) {
 	return ln.Addr().(*net.TCPAddr).Port, nil
 }
 
+// assertReloadMessage checks that message is a reload for wantPath
+func assertReloadMessage(t *testing.T, message []byte, wantPath string) {
+	t.Helper()
+	var msg reloadMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		t.Fatalf("Expected JSON reload message, got %q: %v", string(message), err)
+	}
+	if msg.Type != "reload" || msg.Path != wantPath {
+		t.Errorf("Expected reload for %q, got %q", wantPath, string(message))
+	}
+}
+
 func TestLiveReloadIntegration(t *testing.T) {
 	// Create a temporary directory for the test
 	tmpDir, err := os.MkdirTemp("", "mdserver-test-*")
@@ -61,7 +75,7 @@ func TestLiveReloadIntegration(t *testing.T) {
 	// Start server in a goroutine
 	serverErr := make(chan error, 1)
 	go func() {
-		serverErr <- srv.Start()
+		serverErr <- srv.Start(context.Background())
 	}()
 
 	// Give server time to start
@@ -69,7 +83,7 @@ func TestLiveReloadIntegration(t *testing.T) {
 
 	// Ensure server is stopped at the end
 	defer func() {
-		srv.Stop()
+		srv.Shutdown(context.Background())
 		// Wait a bit for cleanup
 		time.Sleep(50 * time.Millisecond)
 	}()
@@ -127,9 +141,7 @@ func TestLiveReloadIntegration(t *testing.T) {
 		t.Errorf("Expected text message, got %d", messageType)
 	}
 
-	if string(message) != "reload" {
-		t.Errorf("Expected 'reload' message, got %q", string(message))
-	}
+	assertReloadMessage(t, message, "/test.md")
 
 	// Verify the updated content is served
 	resp2, err := http.Get(baseURL + "/test.md")
@@ -183,14 +195,14 @@ func TestEnsureWatchingDeepDirectory(t *testing.T) {
 
 	// Start server in a goroutine
 	go func() {
-		_ = srv.Start()
+		_ = srv.Start(context.Background())
 	}()
 
 	// Give server time to start
 	time.Sleep(100 * time.Millisecond)
 
 	defer func() {
-		srv.Stop()
+		srv.Shutdown(context.Background())
 		time.Sleep(50 * time.Millisecond)
 	}()
 
@@ -233,9 +245,7 @@ func TestEnsureWatchingDeepDirectory(t *testing.T) {
 		t.Fatalf("Failed to read WebSocket message after EnsureWatching: %v", err)
 	}
 
-	if string(message) != "reload" {
-		t.Errorf("Expected 'reload' message, got %q", string(message))
-	}
+	assertReloadMessage(t, message, "/a/b/c/test.md")
 }
 
 func TestLiveReloadMultipleClients(t *testing.T) {
@@ -273,7 +283,7 @@ func TestLiveReloadMultipleClients(t *testing.T) {
 
 	// Start server in a goroutine
 	go func() {
-		_ = srv.Start()
+		_ = srv.Start(context.Background())
 	}()
 
 	// Give server time to start
@@ -281,7 +291,7 @@ func TestLiveReloadMultipleClients(t *testing.T) {
 
 	// Ensure server is stopped at the end
 	defer func() {
-		srv.Stop()
+		srv.Shutdown(context.Background())
 		time.Sleep(50 * time.Millisecond)
 	}()
 
@@ -340,9 +350,7 @@ func TestLiveReloadMultipleClients(t *testing.T) {
 	// Wait for both messages or timeout
 	select {
 	case m := <-msg1:
-		if string(m) != "reload" {
-			t.Errorf("Client 1: Expected 'reload', got %q", string(m))
-		}
+		assertReloadMessage(t, m, "/test.md")
 	case err := <-err1:
 		t.Errorf("Client 1 error: %v", err)
 	case <-time.After(2 * time.Second):
@@ -351,9 +359,7 @@ func TestLiveReloadMultipleClients(t *testing.T) {
 
 	select {
 	case m := <-msg2:
-		if string(m) != "reload" {
-			t.Errorf("Client 2: Expected 'reload', got %q", string(m))
-		}
+		assertReloadMessage(t, m, "/test.md")
 	case err := <-err2:
 		t.Errorf("Client 2 error: %v", err)
 	case <-time.After(2 * time.Second):
@@ -392,13 +398,13 @@ func TestLiveReloadAtomicSaveRename(t *testing.T) {
 	}
 
 	go func() {
-		_ = srv.Start()
+		_ = srv.Start(context.Background())
 	}()
 
 	time.Sleep(100 * time.Millisecond)
 
 	defer func() {
-		srv.Stop()
+		srv.Shutdown(context.Background())
 		time.Sleep(50 * time.Millisecond)
 	}()
 
@@ -431,9 +437,7 @@ func TestLiveReloadAtomicSaveRename(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to read WebSocket message after atomic save: %v", err)
 	}
-	if string(message) != "reload" {
-		t.Errorf("Expected 'reload' message, got %q", string(message))
-	}
+	assertReloadMessage(t, message, "/test.md")
 
 	resp2, err := http.Get(baseURL + "/test.md")
 	if err != nil {
@@ -449,3 +453,371 @@ func TestLiveReloadAtomicSaveRename(t *testing.T) {
 		t.Errorf("Updated content not found in response. Got: %s", string(body2))
 	}
 }
+
+func TestLiveReloadResolvePage(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"docs/guide.md", "my notes.md"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("# Doc\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lr := &LiveReload{rootDir: tmpDir}
+
+	tests := []struct {
+		urlPath string
+		want    clientPage
+		wantOK  bool
+	}{
+		{"/", clientPage{path: tmpDir, isDir: true}, true},
+		{"/docs/", clientPage{path: filepath.Join(tmpDir, "docs"), isDir: true}, true},
+		{"/docs/guide.md", clientPage{path: filepath.Join(tmpDir, "docs", "guide.md")}, true},
+		{"/docs/guide", clientPage{path: filepath.Join(tmpDir, "docs", "guide.md")}, true},
+		{"/my%20notes.md", clientPage{path: filepath.Join(tmpDir, "my notes.md")}, true},
+		{"/../docs/guide.md", clientPage{path: filepath.Join(tmpDir, "docs", "guide.md")}, true},
+		{"/settings", clientPage{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := lr.resolvePage(tt.urlPath)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("resolvePage(%q) = %+v, %t; want %+v, %t", tt.urlPath, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestLiveReloadTargetsRegisteredPages(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.md", "b.md"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("# Doc\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	port, err := findAvailablePort()
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	srv := NewServer(Config{
+		Host:             "localhost",
+		Port:             port,
+		RootDir:          tmpDir,
+		EnableLiveReload: true,
+	})
+	if srv.liveReload == nil {
+		t.Fatal("LiveReload was not initialized")
+	}
+	go func() {
+		_ = srv.Start(context.Background())
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer func() {
+		srv.Shutdown(context.Background())
+		time.Sleep(50 * time.Millisecond)
+	}()
+
+	// One client per page, each registering what it is viewing
+	wsURL := "ws://localhost:" + strconv.Itoa(port) + "/livereload"
+	pages := []string{"/a.md", "/b", "/sub/", "/settings"}
+	conns := make(map[string]*websocket.Conn)
+	for _, page := range pages {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("Failed to connect client for %s: %v", page, err)
+		}
+		defer conn.Close()
+		if err := conn.WriteJSON(registerMessage{Type: "register", Path: page}); err != nil {
+			t.Fatalf("Failed to register %s: %v", page, err)
+		}
+		conns[page] = conn
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// A changed document reloads only its own page; a new file reloads the
+	// listing of its directory
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.md"), []byte("# Changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "sub", "new.md"), []byte("# New\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"/a.md": "/a.md",
+		"/sub/": "/sub/new.md",
+	}
+
+	for _, page := range pages {
+		conn := conns[page]
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, message, err := conn.ReadMessage()
+		wantPath, ok := want[page]
+		switch {
+		case ok && err != nil:
+			t.Errorf("%s: expected reload for %s, got error: %v", page, wantPath, err)
+		case ok:
+			assertReloadMessage(t, message, wantPath)
+		case err == nil:
+			t.Errorf("%s: unexpected message %q", page, string(message))
+		}
+	}
+}
+
+func TestLiveReloadPatchMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte("# Doc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := findAvailablePort()
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	srv := NewServer(Config{
+		Host:             "localhost",
+		Port:             port,
+		RootDir:          tmpDir,
+		EnableLiveReload: true,
+		ReloadMode:       ReloadModePatch,
+	})
+	if srv.liveReload == nil {
+		t.Fatal("LiveReload was not initialized")
+	}
+	go func() {
+		_ = srv.Start(context.Background())
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer func() {
+		srv.Shutdown(context.Background())
+		time.Sleep(50 * time.Millisecond)
+	}()
+
+	// The page template must mark the content so the client can patch it
+	resp, err := http.Get("http://localhost:" + strconv.Itoa(port) + "/doc.md")
+	if err != nil {
+		t.Fatalf("Failed to fetch page: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `<div id="content">`) {
+		t.Errorf("Expected content wrapper in page, got: %s", body)
+	}
+
+	wsURL := "ws://localhost:" + strconv.Itoa(port) + "/livereload"
+	pageConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer pageConn.Close()
+	if err := pageConn.WriteJSON(registerMessage{Type: "register", Path: "/doc"}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	listingConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer listingConn.Close()
+	if err := listingConn.WriteJSON(registerMessage{Type: "register", Path: "/"}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte("# Patched\n\nNew paragraph.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The document's own page gets its new content in place. WriteFile
+	// truncates first, so there may be a patch for the empty file before it.
+	pageConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var patch patchMessage
+	for patch.Title != "Patched" {
+		if err := pageConn.ReadJSON(&patch); err != nil {
+			t.Fatalf("Failed to read patch message: %v", err)
+		}
+		if patch.Type != "patch" || patch.Path != "/doc.md" {
+			t.Fatalf("Unexpected patch message: %+v", patch)
+		}
+	}
+	if !strings.Contains(patch.HTML, "<p>New paragraph.</p>") {
+		t.Errorf("Expected rendered content in patch, got %q", patch.HTML)
+	}
+	if patch.TOC != `<ul><li><a href="#patched">Patched</a></li></ul>` {
+		t.Errorf("Expected updated TOC in patch, got %q", patch.TOC)
+	}
+
+	// ...while the directory listing still reloads
+	listingConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := listingConn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read reload message: %v", err)
+	}
+	assertReloadMessage(t, message, "/doc.md")
+}
+
+func TestLiveReloadAssetChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{"doc.md": "# Doc\n\n![logo](logo.png)\n", "logo.png": "v1"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	port, err := findAvailablePort()
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	srv := NewServer(Config{
+		Host:             "localhost",
+		Port:             port,
+		RootDir:          tmpDir,
+		EnableLiveReload: true,
+	})
+	if srv.liveReload == nil {
+		t.Fatal("LiveReload was not initialized")
+	}
+	go func() {
+		_ = srv.Start(context.Background())
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer func() {
+		srv.Shutdown(context.Background())
+		time.Sleep(50 * time.Millisecond)
+	}()
+
+	wsURL := "ws://localhost:" + strconv.Itoa(port) + "/livereload"
+	dial := func(page string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		if page != "" {
+			if err := conn.WriteJSON(registerMessage{Type: "register", Path: page}); err != nil {
+				t.Fatalf("Failed to register %s: %v", page, err)
+			}
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		return conn
+	}
+	docConn := dial("/doc.md")
+	defer docConn.Close()
+	listingConn := dial("/")
+	defer listingConn.Close()
+	unregistered := dial("")
+	defer unregistered.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// readMessage returns the first message about path, skipping repeats
+	// for earlier changes (a write can produce more than one event)
+	readMessage := func(conn *websocket.Conn, path string) reloadMessage {
+		t.Helper()
+		for {
+			var msg reloadMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("Failed to read message for %s: %v", path, err)
+			}
+			if msg.Path == path {
+				return msg
+			}
+		}
+	}
+
+	// Editing an existing asset tells every registered page about it
+	if err := os.WriteFile(filepath.Join(tmpDir, "logo.png"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := reloadMessage{Type: "asset", Path: "/logo.png"}
+	if msg := readMessage(docConn, want.Path); msg != want {
+		t.Errorf("Document page got %+v, want %+v", msg, want)
+	}
+	if msg := readMessage(listingConn, want.Path); msg != want {
+		t.Errorf("Listing page got %+v, want %+v", msg, want)
+	}
+
+	// Adding a file reloads the listing of its directory
+	if err := os.WriteFile(filepath.Join(tmpDir, "new.css"), []byte("body {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want = reloadMessage{Type: "asset", Path: "/new.css"}
+	if msg := readMessage(docConn, want.Path); msg != want {
+		t.Errorf("Document page got %+v, want %+v", msg, want)
+	}
+	want = reloadMessage{Type: "reload", Path: "/new.css"}
+	if msg := readMessage(listingConn, want.Path); msg != want {
+		t.Errorf("Listing page got %+v, want %+v", msg, want)
+	}
+
+	// Clients that never registered only get reloads for documents
+	unregistered.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if _, message, err := unregistered.ReadMessage(); err == nil {
+		t.Errorf("Unregistered client got unexpected message %q", string(message))
+	}
+}
+
+func TestLiveReloadBroadcastAfterStop(t *testing.T) {
+	tmpDir := t.TempDir()
+	lr, err := NewLiveReload(tmpDir, NewIgnoreMatcher(tmpDir, nil), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	lr.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		lr.broadcastReload(filepath.Join(tmpDir, "doc.md"), "WRITE")
+		lr.broadcastAsset(filepath.Join(tmpDir, "image.png"), 0)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Broadcasting after Stop blocked")
+	}
+}
+
+func TestLiveReloadOnChangeSkipsIgnoredFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, ".gitignore"), []byte("drafts.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lr, err := NewLiveReload(tmpDir, NewIgnoreMatcher(tmpDir, nil), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan string, 10)
+	lr.OnChange(func(path string) { changed <- filepath.Base(path) })
+	if err := lr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer lr.Stop()
+
+	// The ignored file is written first, so its event would arrive first
+	for _, name := range []string{"drafts.md", "doc.md", ".gitignore"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("text\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	var got []string
+	timeout := time.After(2 * time.Second)
+	for len(got) == 0 || got[len(got)-1] != ".gitignore" {
+		select {
+		case name := <-changed:
+			if name == "drafts.md" {
+				t.Fatal("OnChange was called for an ignored file")
+			}
+			got = append(got, name)
+		case <-timeout:
+			t.Fatalf("Expected changes to doc.md and .gitignore, got %v", got)
+		}
+	}
+	if got[0] != "doc.md" {
+		t.Errorf("Expected doc.md to be reported, got %v", got)
+	}
+}
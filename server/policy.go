@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultDenyPatterns keep secrets from being served: dotfiles and
+// directories (.env, .git, ...) at any depth, and private keys. Configured
+// patterns can re-allow them with "!".
+var defaultDenyPatterns = []string{
+	".*",
+	"*.pem",
+	"*.key",
+}
+
+// servePolicy decides which files and directories under the root may be served
+type servePolicy struct {
+	rootDir        string
+	resolvedRoot   string // rootDir with symbolic links resolved
+	followSymlinks bool
+	deny           []ignoreRule
+	allowExts      map[string]bool // Lowercase extensions with the dot; nil allows all
+}
+
+// newServePolicy creates the policy from the server configuration
+func newServePolicy(config Config) *servePolicy {
+	p := &servePolicy{
+		rootDir:        config.RootDir,
+		followSymlinks: config.FollowSymlinks,
+		deny:           compileIgnoreRules("", append(defaultDenyPatterns[:len(defaultDenyPatterns):len(defaultDenyPatterns)], config.DenyPatterns...)),
+	}
+	if abs, err := filepath.Abs(p.rootDir); err == nil {
+		p.rootDir = abs
+	}
+	p.resolvedRoot = p.rootDir
+	if resolved, err := filepath.EvalSymlinks(p.rootDir); err == nil {
+		p.resolvedRoot = resolved
+	}
+	if len(config.AllowExtensions) > 0 {
+		p.allowExts = map[string]bool{".md": true}
+		for _, ext := range config.AllowExtensions {
+			p.allowExts["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = true
+		}
+	}
+	return p
+}
+
+// allowed reports whether path may be served. It must be inside the root
+// both as given and once symbolic links are resolved, and must not go through
+// a symbolic link at all unless links are followed. Neither path may match a
+// deny pattern, and files need an allowed extension.
+func (p *servePolicy) allowed(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, ok := relInside(p.rootDir, abs)
+	if !ok || rel == "" {
+		return false
+	}
+
+	resolved, err := resolvePath(abs)
+	if err != nil {
+		return false
+	}
+	target, ok := relInside(p.resolvedRoot, resolved)
+	if !ok || target == "" {
+		return false
+	}
+	if !p.followSymlinks && target != rel {
+		return false
+	}
+
+	isDir := false
+	if info, err := os.Stat(resolved); err == nil {
+		isDir = info.IsDir()
+	}
+	if p.denied(rel, isDir) || p.denied(target, isDir) {
+		return false
+	}
+	if !isDir && p.allowExts != nil {
+		return p.allowExts[strings.ToLower(filepath.Ext(rel))] && p.allowExts[strings.ToLower(filepath.Ext(target))]
+	}
+	return true
+}
+
+// denied reports whether rel, or a directory above it, matches a deny pattern
+func (p *servePolicy) denied(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if matchRules(p.deny, strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return matchRules(p.deny, rel, isDir)
+}
+
+// relInside returns path relative to root with forward slashes, "" for root
+// itself. ok is false for paths outside root.
+func relInside(root, path string) (rel string, ok bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	if rel == "." {
+		rel = ""
+	}
+	return rel, true
+}
+
+// resolvePath resolves the symbolic links in path. For a path that doesn't
+// exist, the links in its longest existing parent are resolved.
+func resolvePath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return resolved, err
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	dir, err := resolvePath(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
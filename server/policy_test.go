@@ -0,0 +1,137 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServePolicy(t *testing.T) {
+	base := t.TempDir()
+	tmpDir := filepath.Join(base, "docs")
+	writeFiles(t, tmpDir, map[string]string{
+		"doc.md":             "# Doc\n",
+		"img.png":            "png",
+		"sub/.env":           "SECRET=1",
+		"sub/notes.txt":      "notes",
+		"certs/server.pem":   "key",
+		"drafts/plan.md":     "# Plan\n",
+		".well-known/a.txt":  "a",
+		"shared/readme.md":   "# Shared\n",
+		"shared/diagram.png": "png",
+	})
+	writeFiles(t, base, map[string]string{"outside/secret.txt": "secret"})
+	for link, target := range map[string]string{
+		"link-in.md":   "doc.md",
+		"link-out.txt": filepath.Join(base, "outside", "secret.txt"),
+		"dirlink":      filepath.Join(base, "outside"),
+		"dotlink.txt":  filepath.Join("sub", ".env"),
+		"sharedlink":   "shared",
+	} {
+		if err := os.Symlink(target, filepath.Join(tmpDir, link)); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		status map[string]int
+	}{
+		{
+			name:   "follow symlinks",
+			config: Config{FollowSymlinks: true},
+			status: map[string]int{
+				"/doc.md":               http.StatusOK,
+				"/img.png":              http.StatusOK,
+				"/missing.png":          http.StatusNotFound,
+				"/sub/.env":             http.StatusForbidden,
+				"/certs/server.pem":     http.StatusForbidden,
+				"/link-in.md":           http.StatusOK,
+				"/link-in":              http.StatusOK,
+				"/link-out.txt":         http.StatusForbidden,
+				"/dirlink/":             http.StatusForbidden,
+				"/dirlink/secret.txt":   http.StatusForbidden,
+				"/assets/link-out.txt":  http.StatusForbidden,
+				"/dotlink.txt":          http.StatusForbidden,
+				"/sharedlink/":          http.StatusOK,
+				"/sharedlink/readme.md": http.StatusOK,
+				"/.well-known/a.txt":    http.StatusForbidden,
+			},
+		},
+		{
+			name:   "no symlinks",
+			config: Config{},
+			status: map[string]int{
+				"/doc.md":                        http.StatusOK,
+				"/link-in.md":                    http.StatusForbidden,
+				"/sharedlink/":                   http.StatusForbidden,
+				"/assets/sharedlink/diagram.png": http.StatusForbidden,
+				"/shared/diagram.png":            http.StatusOK,
+			},
+		},
+		{
+			name:   "deny patterns",
+			config: Config{DenyPatterns: []string{"drafts/", "!.well-known/"}},
+			status: map[string]int{
+				"/drafts/plan.md":    http.StatusForbidden,
+				"/drafts/":           http.StatusForbidden,
+				"/.well-known/a.txt": http.StatusOK,
+				"/sub/.env":          http.StatusForbidden,
+			},
+		},
+		{
+			name:   "allowed extensions",
+			config: Config{AllowExtensions: []string{"png"}},
+			status: map[string]int{
+				"/doc.md":         http.StatusOK,
+				"/img.png":        http.StatusOK,
+				"/assets/img.png": http.StatusOK,
+				"/sub/notes.txt":  http.StatusForbidden,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.RootDir = tmpDir
+			srv := NewServer(tt.config)
+			for path, want := range tt.status {
+				rec := httptest.NewRecorder()
+				srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != want {
+					t.Errorf("GET %s: status %d, want %d", path, rec.Code, want)
+				}
+			}
+		})
+	}
+
+	// Markdown files are checked even when handed to the handler directly
+	srv := NewServer(Config{RootDir: tmpDir})
+	rec := httptest.NewRecorder()
+	srv.handleMarkdown(rec, httptest.NewRequest(http.MethodGet, "/", nil), filepath.Join(tmpDir, "link-in.md"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("handleMarkdown through a symlink: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+// writeUnservedFixtures creates a root directory with pages the serving
+// policy rejects: a symbolic link to a page outside the root, and a directory
+// denied by the returned config. All of them mention "classified" and link to
+// guide.md.
+func writeUnservedFixtures(t *testing.T) Config {
+	t.Helper()
+	base := t.TempDir()
+	rootDir := filepath.Join(base, "docs")
+	writeFiles(t, rootDir, map[string]string{
+		"README.md":       "# Home\n",
+		"guide.md":        "# Guide\n",
+		"private/plan.md": "# Plan\n\nclassified [guide](../guide.md)\n",
+	})
+	writeFiles(t, base, map[string]string{"outside/secret.md": "# Secret\n\nclassified [guide](../docs/guide.md)\n"})
+	if err := os.Symlink(filepath.Join(base, "outside", "secret.md"), filepath.Join(rootDir, "leak.md")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	return Config{RootDir: rootDir, DenyPatterns: []string{"private/"}, FollowSymlinks: true}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often the tree is scanned for changes when live reload is off
+const pollInterval = 2 * time.Second
+
+// fileStamp identifies a version of a file, like the keys of fileCache
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// same reports whether both stamps are of the same version
+func (s fileStamp) same(other fileStamp) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size
+}
+
+// treePoller finds markdown and ignore files under a root directory that
+// were added, changed or removed, by comparing modification times and sizes
+// between scans. It keeps the search, wiki and link indexes current where no
+// file watcher reports changes: everywhere when live reload is off, and below
+// the directories it watches when it is on.
+type treePoller struct {
+	rootDir string
+	ignore  *IgnoreMatcher
+	allowed func(path string) bool // Serving policy; other files aren't indexed
+	stamps  map[string]fileStamp   // Absolute path -> stamp at the last scan
+}
+
+func newTreePoller(rootDir string, ignore *IgnoreMatcher, allowed func(path string) bool) *treePoller {
+	return &treePoller{rootDir: rootDir, ignore: ignore, allowed: allowed}
+}
+
+// scan returns the stamps of the markdown and ignore files below the root
+func (p *treePoller) scan() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	stamp := func(path string) {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	walkServed(p.rootDir, p.ignore, p.allowed, func(path string, d fs.DirEntry) error {
+		if !d.IsDir() {
+			if isMarkdownFile(path) {
+				stamp(path)
+			}
+			return nil
+		}
+		// Like the watcher, skip heavy directories
+		if path != p.rootDir && skipDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		// Ignore files are ignored themselves, but changes to them matter
+		for _, name := range ignoreFiles {
+			stamp(filepath.Join(path, name))
+		}
+		return nil
+	})
+	return stamps
+}
+
+// changes scans the tree and returns the files added, changed or removed
+// since the previous call. The first call only records the current state.
+// Changed ignore files come first, and their rules are reloaded before the
+// other files are compared, so files they hide or show count as removed or
+// added.
+func (p *treePoller) changes() []string {
+	stamps := p.scan()
+	if p.stamps == nil {
+		p.stamps = stamps
+		return nil
+	}
+
+	var changed []string
+	for path, stamp := range stamps {
+		if isIgnoreFile(filepath.Base(path)) && !p.stamps[path].same(stamp) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range p.stamps {
+		if _, ok := stamps[path]; !ok && isIgnoreFile(filepath.Base(path)) {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) > 0 {
+		for _, path := range changed {
+			p.ignore.FileChanged(path)
+		}
+		stamps = p.scan()
+	}
+
+	for path, stamp := range stamps {
+		if old, ok := p.stamps[path]; (!ok || !old.same(stamp)) && !isIgnoreFile(filepath.Base(path)) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range p.stamps {
+		if _, ok := stamps[path]; !ok && !isIgnoreFile(filepath.Base(path)) {
+			changed = append(changed, path)
+		}
+	}
+	p.stamps = stamps
+	return changed
+}
+
+// poll calls onChange with every changed file, scanning the tree every
+// interval until stop is closed
+func (p *treePoller) poll(interval time.Duration, stop <-chan struct{}, onChange func(path string)) {
+	p.changes()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, path := range p.changes() {
+				onChange(path)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
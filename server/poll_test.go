@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTreePollerChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md":     "# Home\n",
+		"docs/guide.md": "# Guide\n",
+		"old.md":        "# Old\n",
+		"notes.txt":     "notes",
+		"drafts/a.md":   "# A\n",
+	})
+	p := newTreePoller(tmpDir, NewIgnoreMatcher(tmpDir, nil), newServePolicy(Config{RootDir: tmpDir}).allowed)
+	if got := p.changes(); got != nil {
+		t.Fatalf("Expected the first scan to report nothing, got %v", got)
+	}
+
+	writeFiles(t, tmpDir, map[string]string{
+		"docs/guide.md":   "# Guide\n\nMore.\n",
+		"new.md":          "# New\n",
+		"notes.txt":       "more notes",
+		"node_modules/x":  "x",
+		".mdserverignore": "drafts/\n",
+	})
+	if err := os.Remove(filepath.Join(tmpDir, "old.md")); err != nil {
+		t.Fatal(err)
+	}
+	got := p.changes()
+	if len(got) == 0 || got[0] != filepath.Join(tmpDir, ".mdserverignore") {
+		t.Fatalf("Expected the changed ignore file first, got %v", got)
+	}
+	pages := got[1:]
+	sort.Strings(pages)
+	want := []string{
+		filepath.Join(tmpDir, "docs", "guide.md"),
+		filepath.Join(tmpDir, "drafts", "a.md"), // Now ignored
+		filepath.Join(tmpDir, "new.md"),
+		filepath.Join(tmpDir, "old.md"),
+	}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("changes() = %v, want %v", pages, want)
+	}
+
+	if got := p.changes(); got != nil {
+		t.Errorf("Expected no changes without edits, got %v", got)
+	}
+}
+
+func TestServerPollsForChanges(t *testing.T) {
+	// The watcher only covers the top of the tree, so deeper changes reach the
+	// indexes through polling whether live reload is on or not
+	for _, liveReload := range []bool{false, true} {
+		t.Run(fmt.Sprintf("live reload %t", liveReload), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeFiles(t, tmpDir, map[string]string{
+				"a/b/notes.md": "# Notes\n\n[a](../../a.md)\n",
+				"a.md":         "# A\n",
+			})
+			port, err := findAvailablePort()
+			if err != nil {
+				t.Fatalf("Failed to find available port: %v", err)
+			}
+			srv := NewServer(Config{Host: "localhost", Port: port, RootDir: tmpDir, EnableLiveReload: liveReload})
+			go func() {
+				_ = srv.Start(context.Background())
+			}()
+			defer srv.Shutdown(context.Background())
+
+			page := filepath.Join(tmpDir, "a.md")
+			if got := srv.links.Backlinks(page); len(got) != 1 {
+				t.Fatalf("Expected 1 backlink, got %v", got)
+			}
+			if got := srv.search.Search("walrus"); len(got) != 0 {
+				t.Fatalf("Expected no search results, got %v", got)
+			}
+			// Let the poller record the tree before it changes
+			time.Sleep(100 * time.Millisecond)
+
+			writeFiles(t, tmpDir, map[string]string{"a/b/notes.md": "# Notes\n\nA walrus.\n"})
+			deadline := time.Now().Add(3 * pollInterval)
+			for len(srv.links.Backlinks(page)) != 0 || len(srv.search.Search("walrus")) != 1 {
+				if time.Now().After(deadline) {
+					t.Fatal("Backlinks and search were not updated")
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package server
+
+import (
+	"html"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"mdserver/renderer"
+)
+
+const (
+	maxSearchResults = 50 // Maximum number of documents returned
+	maxSearchHits    = 3  // Maximum number of snippets shown per document
+	snippetBefore    = 60 // Bytes of context before the first match in a snippet
+	snippetLength    = 200
+)
+
+// SearchResult is a document matching a search query
+type SearchResult struct {
+	Path    string // URL path of the document
+	RelPath string
+	Title   string
+	Hits    []SearchHit
+	score   int
+}
+
+// SearchHit is a matching section within a document
+type SearchHit struct {
+	Heading string
+	Href    string // URL of the section, including the heading anchor
+	Snippet template.HTML
+}
+
+// indexedDoc holds the searchable content of a markdown file
+type indexedDoc struct {
+	relPath  string
+	title    string
+	sections []renderer.Section
+	terms    map[string]int // term -> occurrences
+}
+
+// SearchIndex is an in-memory inverted index over all markdown files under a root directory.
+// It is built lazily on the first search and kept current through Update.
+type SearchIndex struct {
+	rootDir  string
+	ignore   *IgnoreMatcher
+	allowed  func(path string) bool // Serving policy; other files aren't indexed
+	mu       sync.RWMutex
+	built    bool
+	docs     map[string]*indexedDoc    // absolute path -> document
+	postings map[string]map[string]int // term -> absolute path -> occurrences
+}
+
+// NewSearchIndex creates an empty index for rootDir. Files matched by ignore,
+// and files and directories the server wouldn't serve according to allowed,
+// are not indexed.
+func NewSearchIndex(rootDir string, ignore *IgnoreMatcher, allowed func(path string) bool) *SearchIndex {
+	return &SearchIndex{
+		rootDir:  rootDir,
+		ignore:   ignore,
+		allowed:  allowed,
+		docs:     make(map[string]*indexedDoc),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// ensureBuilt indexes every markdown file under the root directory if that hasn't been done yet
+func (idx *SearchIndex) ensureBuilt() {
+	idx.mu.RLock()
+	built := idx.built
+	idx.mu.RUnlock()
+	if built {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.built {
+		return
+	}
+	idx.indexTree(idx.rootDir)
+	idx.built = true
+	log.Printf("search: indexed %d files", len(idx.docs))
+}
+
+// indexTree adds all markdown files under dir. Caller must hold the write lock.
+func (idx *SearchIndex) indexTree(dir string) {
+	walkServedMarkdown(dir, idx.ignore, idx.allowed, func(path string) error {
+		idx.indexFile(path)
+		return nil
+	})
+}
+
+// indexFile (re)indexes a single markdown file. Caller must hold the write lock.
+func (idx *SearchIndex) indexFile(path string) {
+	idx.removeFile(path)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	relPath, err := filepath.Rel(idx.rootDir, path)
+	if err != nil {
+		return
+	}
+
+	doc := &indexedDoc{
+		relPath:  relPath,
+		title:    renderer.Title(content),
+		sections: renderer.ExtractSections(content),
+		terms:    make(map[string]int),
+	}
+	if doc.title == "" {
+		doc.title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	for _, term := range tokenize(doc.title) {
+		doc.terms[term]++
+	}
+	for _, section := range doc.sections {
+		for _, term := range tokenize(section.Heading) {
+			doc.terms[term]++
+		}
+		for _, term := range tokenize(section.Text) {
+			doc.terms[term]++
+		}
+	}
+
+	idx.docs[path] = doc
+	for term, count := range doc.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]int)
+		}
+		idx.postings[term][path] = count
+	}
+}
+
+// removeFile drops a file from the index. Caller must hold the write lock.
+func (idx *SearchIndex) removeFile(path string) {
+	doc, ok := idx.docs[path]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(idx.postings[term], path)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, path)
+}
+
+// Update refreshes the index for a changed path. Markdown files are re-read or
+// removed; a created directory is indexed and a removed one is dropped. A
+// changed ignore file resets the index.
+func (idx *SearchIndex) Update(path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if !idx.built {
+		// Nothing to keep current yet; the first search reads everything
+		return
+	}
+
+	path = filepath.Clean(path)
+	if isIgnoreFile(filepath.Base(path)) {
+		// Any file below may have become ignored or visible: rebuild on next search
+		idx.docs = make(map[string]*indexedDoc)
+		idx.postings = make(map[string]map[string]int)
+		idx.built = false
+		return
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err != nil, !idx.allowed(path):
+		// Removed, renamed away or not served, such as a symbolic link that
+		// now points outside the root: drop the file and anything below it
+		idx.removeFile(path)
+		prefix := path + string(filepath.Separator)
+		for docPath := range idx.docs {
+			if strings.HasPrefix(docPath, prefix) {
+				idx.removeFile(docPath)
+			}
+		}
+	case idx.ignore.Ignored(path, info.IsDir()):
+		return
+	case info.IsDir():
+		idx.indexTree(path)
+	case isMarkdownFile(path):
+		idx.indexFile(path)
+	}
+}
+
+// Search returns documents containing every term in query, best matches first.
+// Each query term matches any indexed term it is a prefix of.
+func (idx *SearchIndex) Search(query string) []SearchResult {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	idx.ensureBuilt()
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Score documents, keeping only those that match all terms
+	var scores map[string]int
+	for _, term := range terms {
+		matches := make(map[string]int)
+		for indexed, postings := range idx.postings {
+			if !strings.HasPrefix(indexed, term) {
+				continue
+			}
+			for path, count := range postings {
+				matches[path] += count
+			}
+		}
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		for path := range scores {
+			if count, ok := matches[path]; ok {
+				scores[path] += count
+			} else {
+				delete(scores, path)
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for path, score := range scores {
+		doc := idx.docs[path]
+		// Title matches rank above body matches
+		for _, term := range tokenize(doc.title) {
+			if matchesAnyTerm(term, terms) {
+				score += 10
+			}
+		}
+		result := SearchResult{
+			Path:    urlFromRelPath(doc.relPath),
+			RelPath: filepath.ToSlash(doc.relPath),
+			Title:   doc.title,
+			score:   score,
+		}
+		for _, section := range doc.sections {
+			if len(result.Hits) == maxSearchHits {
+				break
+			}
+			snippet, ok := highlightSnippet(section.Text, terms)
+			if !ok && !containsAnyTerm(section.Heading, terms) {
+				continue
+			}
+			href := result.Path
+			if section.ID != "" {
+				href += "#" + section.ID
+			}
+			result.Hits = append(result.Hits, SearchHit{
+				Heading: section.Heading,
+				Href:    href,
+				Snippet: snippet,
+			})
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].RelPath < results[j].RelPath
+	})
+	if len(results) > maxSearchResults {
+		results = results[:maxSearchResults]
+	}
+	return results
+}
+
+// isMarkdownFile reports whether name has a .md extension
+func isMarkdownFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".md")
+}
+
+// token is a word and its byte offsets in the source text
+type token struct {
+	term       string
+	start, end int
+}
+
+// scanTokens splits s into lowercase words made of letters and digits
+func scanTokens(s string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range s {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(s[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(s[start:]), start, len(s)})
+	}
+	return tokens
+}
+
+// tokenize returns the lowercase words in s
+func tokenize(s string) []string {
+	tokens := scanTokens(s)
+	terms := make([]string, len(tokens))
+	for i, t := range tokens {
+		terms[i] = t.term
+	}
+	return terms
+}
+
+func matchesAnyTerm(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyTerm(s string, terms []string) bool {
+	for _, t := range scanTokens(s) {
+		if matchesAnyTerm(t.term, terms) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlightSnippet returns an excerpt of text around the first match with all
+// matching words wrapped in <mark>. ok is false if text doesn't match.
+func highlightSnippet(text string, terms []string) (snippet template.HTML, ok bool) {
+	tokens := scanTokens(text)
+	first := -1
+	for i, t := range tokens {
+		if matchesAnyTerm(t.term, terms) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	// Choose a window around the first match, aligned to rune boundaries
+	start := max(tokens[first].start-snippetBefore, 0)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	end := min(start+snippetLength, len(text))
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, t := range tokens {
+		if t.start < start || t.end > end || !matchesAnyTerm(t.term, terms) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:t.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString("</mark>")
+		pos = t.end
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return template.HTML(b.String()), true
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeSearchFixtures(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"guide.md":            "# User Guide\n\nIntro text.\n\n## Configuration\n\nSet the `<port>` option to configure listening.\n",
+		"docs/design.md":      "# Design\n\nThe watcher configures fsnotify.\n",
+		"docs/other.md":       "# Other\n\nNothing relevant here.\n",
+		"node_modules/pkg.md": "# Vendored\n\nconfiguration\n",
+		".hidden/secret.md":   "# Secret\n\nconfiguration\n",
+		"docs/notes.txt":      "configuration\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	return tmpDir
+}
+
+func TestSearchIndex(t *testing.T) {
+	tmpDir := writeSearchFixtures(t)
+	idx := NewSearchIndex(tmpDir, NewIgnoreMatcher(tmpDir, nil), newServePolicy(Config{RootDir: tmpDir}).allowed)
+
+	results := idx.Search("config")
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d: %+v", len(results), results)
+	}
+	paths := []string{results[0].RelPath, results[1].RelPath, results[2].RelPath}
+	for _, want := range []string{"guide.md", "docs/design.md", "node_modules/pkg.md"} {
+		if !slices.Contains(paths, want) {
+			t.Errorf("Expected %s in results, got %v", want, paths)
+		}
+	}
+
+	var guide SearchResult
+	for _, r := range results {
+		if r.RelPath == "guide.md" {
+			guide = r
+		}
+	}
+	if guide.Title != "User Guide" || guide.Path != "/guide.md" {
+		t.Errorf("Unexpected result metadata: %+v", guide)
+	}
+	if len(guide.Hits) == 0 || guide.Hits[0].Heading != "Configuration" {
+		t.Fatalf("Expected hit under Configuration heading, got %+v", guide.Hits)
+	}
+	if guide.Hits[0].Href != "/guide.md#configuration" {
+		t.Errorf("Expected anchor link, got %q", guide.Hits[0].Href)
+	}
+	snippet := string(guide.Hits[0].Snippet)
+	if !strings.Contains(snippet, "<mark>configure</mark>") {
+		t.Errorf("Expected highlighted match in snippet, got %q", snippet)
+	}
+	if !strings.Contains(snippet, "&lt;port&gt;") {
+		t.Errorf("Snippet text should be HTML-escaped, got %q", snippet)
+	}
+
+	// All terms must match
+	if results := idx.Search("config watcher"); len(results) != 1 || results[0].RelPath != "docs/design.md" {
+		t.Errorf("Expected only design.md for multi-term query, got %+v", results)
+	}
+	if results := idx.Search("   "); results != nil {
+		t.Errorf("Expected no results for empty query, got %+v", results)
+	}
+}
+
+func TestSearchIndexUpdate(t *testing.T) {
+	tmpDir := writeSearchFixtures(t)
+	idx := NewSearchIndex(tmpDir, NewIgnoreMatcher(tmpDir, nil), newServePolicy(Config{RootDir: tmpDir}).allowed)
+	idx.Search("anything") // build the index
+
+	other := filepath.Join(tmpDir, "docs", "other.md")
+	if err := os.WriteFile(other, []byte("# Other\n\nNow mentions zeppelin.\n"), 0644); err != nil {
+		t.Fatalf("Failed to update file: %v", err)
+	}
+	idx.Update(other)
+	if results := idx.Search("zeppelin"); len(results) != 1 {
+		t.Errorf("Expected updated file to be found, got %+v", results)
+	}
+
+	os.Remove(other)
+	idx.Update(other)
+	if results := idx.Search("zeppelin"); len(results) != 0 {
+		t.Errorf("Expected removed file to be dropped, got %+v", results)
+	}
+
+	newDir := filepath.Join(tmpDir, "added")
+	os.Mkdir(newDir, 0755)
+	os.WriteFile(filepath.Join(newDir, "new.md"), []byte("# New\n\nzeppelin again\n"), 0644)
+	idx.Update(newDir)
+	if results := idx.Search("zeppelin"); len(results) != 1 || results[0].RelPath != "added/new.md" {
+		t.Errorf("Expected files in new directory to be indexed, got %+v", results)
+	}
+
+	os.RemoveAll(newDir)
+	idx.Update(newDir)
+	if results := idx.Search("zeppelin"); len(results) != 0 {
+		t.Errorf("Expected removed directory to be dropped, got %+v", results)
+	}
+}
+
+func TestSearchIndexServingPolicy(t *testing.T) {
+	config := writeUnservedFixtures(t)
+	srv := NewServer(config)
+
+	if results := srv.search.Search("classified"); len(results) != 0 {
+		t.Errorf("Expected no results from unserved files, got %+v", results)
+	}
+
+	// Updates don't index them either
+	srv.search.Update(filepath.Join(config.RootDir, "leak.md"))
+	srv.search.Update(filepath.Join(config.RootDir, "private"))
+	if results := srv.search.Search("classified"); len(results) != 0 {
+		t.Errorf("Expected no results after updates, got %+v", results)
+	}
+}
+
+func TestHandleSearch(t *testing.T) {
+	tmpDir := writeSearchFixtures(t)
+	srv := NewServer(Config{RootDir: tmpDir})
+
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", rec.Code)
+	}
+	html := rec.Body.String()
+	if !strings.Contains(html, `href="/guide.md"`) || !strings.Contains(html, "User Guide") {
+		t.Error("Search page should list matching documents")
+	}
+	if !strings.Contains(html, "<mark>") {
+		t.Error("Search page should highlight matches")
+	}
+	if !strings.Contains(html, `value="config"`) {
+		t.Error("Search box should keep the query")
+	}
+
+	rec = httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/guide.md", nil))
+	if !strings.Contains(rec.Body.String(), `action="/search"`) {
+		t.Error("Markdown pages should include the search box")
+	}
+}
@@ -1,12 +1,22 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"html/template"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"mdserver/renderer"
 )
 
 // Config holds server configuration
@@ -14,55 +24,207 @@ type Config struct {
 	Host             string
 	Port             int
 	RootDir          string
-	File             string
+	File             string // Entry file served at "/" (absolute path)
+	DisableFallback  bool   // Show directory listings instead of README.md/index.md
 	EnableLiveReload bool
+	ReloadMode       string // ReloadModePatch or ReloadModeFull (the default)
 	Verbose          bool
+	Theme            string // Page theme (see renderer.Themes); empty selects renderer.DefaultTheme
+	CodeTheme        string
+	DarkCodeTheme    string   // Code highlighting theme for dark pages
+	DisableMath      bool     // Leave $...$ and fenced math as text and code
+	DisableWikiLinks bool     // Leave [[wiki links]] as text
+	DisableTOC       bool     // No table of contents sidebar or [TOC] markers
+	TemplateDir      string   // Directory whose files override the embedded templates
+	IgnorePatterns   []string // gitignore patterns applied after the root ignore files
+	TLSCert          string   // Certificate file; serves HTTPS when set, together with TLSKey
+	TLSKey           string
+	AuthToken        string   // Access token required from clients (see NewAuthToken); empty for none
+	Users            Htpasswd // Users allowed in with HTTP basic auth; either credential is enough
+	AllowedHosts     []string // Host names accepted besides IP addresses, localhost, Host and the machine name
+	FollowSymlinks   bool     // Serve files through symbolic links that resolve to a path inside RootDir
+	DenyPatterns     []string // gitignore patterns of paths never served, applied after defaultDenyPatterns
+	AllowExtensions  []string // If set, only files with these extensions (and markdown) are served
 }
 
+// Live reload modes
+const (
+	ReloadModeFull  = "full"  // Reload the whole page when its document changes
+	ReloadModePatch = "patch" // Swap in the newly rendered content, keeping scroll position
+)
+
+// ShutdownTimeout is how long Start waits for in-flight requests to finish
+// when it shuts the server down
+const ShutdownTimeout = 5 * time.Second
+
 // Server represents the HTTP server
 type Server struct {
 	config     Config
+	httpServer *http.Server
 	mux        *http.ServeMux
 	liveReload *LiveReload
+	search     *SearchIndex
+	wiki       *WikiIndex
+	links      *LinkGraph
+	ignore     *IgnoreMatcher
+	policy     *servePolicy
+	templates  templateFS
+
+	pageCache     *fileCache[renderedPage]
+	templateCache *fileCache[*template.Template]
+
+	theme   string // Current page theme; can be changed from the settings page
+	themeMu sync.RWMutex
+
+	csrfToken string          // Token the settings forms must send back
+	hostNames map[string]bool // Names accepted in the Host header (see validHost)
+
+	shutdownRequested chan struct{} // Closed when shutdown is requested from the settings page
+	shutdownOnce      sync.Once
 }
 
 // NewServer creates a new server instance
 func NewServer(config Config) *Server {
+	ignore := NewIgnoreMatcher(config.RootDir, config.IgnorePatterns)
+	policy := newServePolicy(config)
 	s := &Server{
-		config: config,
-		mux:    http.NewServeMux(),
+		config:        config,
+		mux:           http.NewServeMux(),
+		search:        NewSearchIndex(config.RootDir, ignore, policy.allowed),
+		wiki:          NewWikiIndex(config.RootDir, ignore, policy.allowed),
+		ignore:        ignore,
+		policy:        policy,
+		templates:     newTemplateFS(config.TemplateDir),
+		pageCache:     newFileCache[renderedPage](),
+		templateCache: newFileCache[*template.Template](),
+		theme:         config.Theme,
+		csrfToken:     rand.Text(),
+		hostNames:     hostNames(config),
+
+		shutdownRequested: make(chan struct{}),
 	}
+	if s.theme == "" {
+		s.theme = renderer.DefaultTheme
+	}
+	s.links = NewLinkGraph(config.RootDir, ignore, policy.allowed, s.pageLinks)
 
 	// Initialize LiveReload if enabled
 	if config.EnableLiveReload {
 		var err error
-		s.liveReload, err = NewLiveReload(config.RootDir, config.Verbose)
+		s.liveReload, err = NewLiveReload(config.RootDir, ignore, config.Verbose)
 		if err != nil {
 			log.Printf("Failed to initialize LiveReload: %v", err)
 		} else {
+			if config.ReloadMode == ReloadModePatch {
+				s.liveReload.SetContentRenderer(s.renderContent)
+			}
 			if err := s.liveReload.Start(); err != nil {
 				log.Printf("Failed to start LiveReload: %v", err)
 				s.liveReload = nil
+			} else {
+				s.liveReload.OnChange(s.fileChanged)
 			}
 		}
 	}
 
 	s.setupRoutes()
+	s.httpServer = &http.Server{
+		Addr:    net.JoinHostPort(config.Host, fmt.Sprint(config.Port)),
+		Handler: s.Handler(),
+	}
+	if s.liveReload != nil {
+		// WebSocket connections are hijacked, so http.Server.Shutdown doesn't wait for them
+		s.httpServer.RegisterOnShutdown(s.liveReload.CloseClients)
+	}
 	return s
 }
 
-// Start starts the HTTP server
-func (s *Server) Start() error {
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-	log.Printf("Listening on %s", addr)
-	return http.ListenAndServe(addr, s.mux)
+// Start serves HTTP, or HTTPS when a certificate is configured, until ctx is
+// done or shutdown is requested from the settings page. It then shuts the
+// server down, giving in-flight requests ShutdownTimeout to finish, and
+// returns nil if that succeeded.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Listening on %s", s.httpServer.Addr)
+
+	// The watcher, if any, only covers the top of the tree and the directories
+	// visited, so poll for changes anywhere to keep search, wiki links and
+	// backlinks from going stale. Changes both report are handled twice, which
+	// is harmless.
+	stopPolling := make(chan struct{})
+	defer close(stopPolling)
+	go newTreePoller(s.config.RootDir, s.ignore, s.policy.allowed).poll(pollInterval, stopPolling, s.fileChanged)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.config.TLSCert != "" {
+			serveErr <- s.httpServer.ServeTLS(listener, s.config.TLSCert, s.config.TLSKey)
+		} else {
+			serveErr <- s.httpServer.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			// Shutdown was called directly; the caller waits for it
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	case <-s.shutdownRequested:
+	}
+
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// Handler returns the handler for all routes, behind authentication when it is configured
+func (s *Server) Handler() http.Handler {
+	if s.authEnabled() {
+		return s.requireAuth(s.mux)
+	}
+	return s.mux
 }
 
-// Stop stops the server and cleans up resources
-func (s *Server) Stop() {
+// Shutdown stops the server gracefully: it stops accepting connections,
+// closes live reload clients with a close frame, waits for in-flight requests
+// to finish until ctx is done, and stops watching files. It can also be used
+// to release a server that was never started.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
 	if s.liveReload != nil {
 		s.liveReload.Stop()
 	}
+	return err
+}
+
+// fileChanged keeps cached pages and the indexes current after a file was
+// written, created, renamed or removed
+func (s *Server) fileChanged(path string) {
+	s.pageCache.invalidate(path)
+	s.search.Update(path)
+	s.updateWikiIndex(path)
+	s.links.Update(path)
+}
+
+// updateWikiIndex keeps the wiki link index current. Rendered pages and the
+// link graph are dropped when links may resolve differently.
+func (s *Server) updateWikiIndex(path string) {
+	if s.wiki.Update(path) {
+		s.pageCache.invalidate(s.config.RootDir)
+		s.links.Reset()
+	}
+}
+
+// requestShutdown makes Start shut the server down
+func (s *Server) requestShutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdownRequested) })
 }
 
 // setupRoutes configures all HTTP routes
@@ -76,13 +238,17 @@ func (s *Server) setupRoutes() {
 
 	// LiveReload WebSocket endpoint
 	if s.liveReload != nil {
-		s.mux.HandleFunc("/livereload", s.liveReload.HandleWebSocket)
+		s.mux.HandleFunc("/livereload", s.protect(s.liveReload.HandleWebSocket))
 	}
 
+	// Full-text search
+	s.mux.HandleFunc("/search", s.handleSearch)
+
 	// Settings routes
 	s.mux.HandleFunc("/settings", s.handleSettings)
-	s.mux.HandleFunc("/settings/shutdown", s.handleShutdown)
-	s.mux.HandleFunc("/settings/remove-watch", s.handleRemoveWatch)
+	s.mux.HandleFunc("/settings/shutdown", s.protect(s.handleShutdown))
+	s.mux.HandleFunc("/settings/remove-watch", s.protect(s.handleRemoveWatch))
+	s.mux.HandleFunc("/settings/theme", s.protect(s.handleTheme))
 
 	// Root handler - handles all other routes including root and markdown files
 	s.mux.HandleFunc("/", s.handleRequest)
@@ -90,33 +256,19 @@ func (s *Server) setupRoutes() {
 
 // handleFavicon serves the markdown favicon
 func (s *Server) handleFavicon(w http.ResponseWriter, r *http.Request) {
-	// Try to find favicon.svg in template directory
-	exePath, err := os.Executable()
-	var faviconPath string
-	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		faviconPath = filepath.Join(exeDir, "template", "favicon.svg")
-		if _, err := os.Stat(faviconPath); os.IsNotExist(err) {
-			// Try relative to current working directory
-			faviconPath = "template/favicon.svg"
-		}
-	} else {
-		faviconPath = "template/favicon.svg"
-	}
-
-	// Check if file exists
-	if _, err := os.Stat(faviconPath); os.IsNotExist(err) {
-		// Serve default markdown icon as SVG
-		w.Header().Set("Content-Type", "image/svg+xml")
-		w.Header().Set("Cache-Control", "public, max-age=86400")
-		w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100"><rect width="100" height="100" rx="20" fill="#000"/><text x="50" y="70" font-family="Arial, sans-serif" font-size="60" font-weight="bold" fill="#fff" text-anchor="middle">M</text></svg>`))
-		return
-	}
-
 	w.Header().Set("Content-Type", "image/svg+xml")
 	// Use shorter cache for initial requests to help Safari pick it up
 	w.Header().Set("Cache-Control", "public, max-age=3600")
-	http.ServeFile(w, r, faviconPath)
+	w.Write(s.favicon())
+}
+
+// favicon returns favicon.svg from the templates
+func (s *Server) favicon() []byte {
+	favicon, err := fs.ReadFile(s.templates, "favicon.svg")
+	if err != nil {
+		log.Printf("Failed to read favicon.svg: %v", err)
+	}
+	return favicon
 }
 
 // handleRequest handles all non-asset requests (root, markdown files, etc.)
@@ -125,8 +277,12 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// Handle root path
 	if requestPath == "/" {
-		// Always serve directory index at root
-		s.handleIndex(w, r, s.config.RootDir)
+		// Redirect to the entry file if one was configured
+		if s.config.File != "" {
+			http.Redirect(w, r, urlFromRelPath(s.relPath(s.config.File)), http.StatusFound)
+			return
+		}
+		s.handleDirectory(w, r, s.config.RootDir)
 		return
 	}
 
@@ -140,12 +296,16 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// Check if path exists and is a directory
 	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		if !s.isValidPath(filePath) {
+			http.Error(w, "Invalid path", http.StatusForbidden)
+			return
+		}
 		// Ensure directory paths end with / for consistency
 		if !strings.HasSuffix(requestPath, "/") && !strings.HasSuffix(r.URL.Path, "/") {
 			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
 			return
 		}
-		s.handleIndex(w, r, filePath)
+		s.handleDirectory(w, r, filePath)
 		return
 	}
 
@@ -169,25 +329,43 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 	s.handleStaticFile(w, r, filePath)
 }
 
-// isValidPath checks if a file path is within the root directory (security)
-func (s *Server) isValidPath(filePath string) bool {
-	absPath, err := filepath.Abs(filePath)
-	if err != nil {
-		return false
-	}
+// fallbackFiles are served in place of a directory listing, in order of preference
+var fallbackFiles = []string{"README.md", "index.md"}
 
-	absRoot, err := filepath.Abs(s.config.RootDir)
-	if err != nil {
-		return false
+// handleDirectory serves a directory's README.md or index.md if present,
+// otherwise the directory listing
+func (s *Server) handleDirectory(w http.ResponseWriter, r *http.Request, dirPath string) {
+	if !s.config.DisableFallback {
+		if fallback := findFallbackFile(dirPath); fallback != "" && s.isValidPath(fallback) {
+			s.handleMarkdown(w, r, fallback)
+			return
+		}
 	}
+	s.handleIndex(w, r, dirPath)
+}
 
-	rel, err := filepath.Rel(absRoot, absPath)
+// findFallbackFile returns the path of the first fallback file in dirPath, or "".
+// Names are matched exactly so results don't depend on filesystem case sensitivity.
+func findFallbackFile(dirPath string) string {
+	entries, err := os.ReadDir(dirPath)
 	if err != nil {
-		return false
+		return ""
 	}
+	for _, name := range fallbackFiles {
+		for _, entry := range entries {
+			if entry.Name() == name && !entry.IsDir() {
+				return filepath.Join(dirPath, name)
+			}
+		}
+	}
+	return ""
+}
 
-	// Prevent directory traversal
-	return rel != ".." && rel != "." && len(rel) > 0 && rel[0] != '.'
+// isValidPath checks if a file path may be served: it must stay within the
+// root directory after resolving symbolic links, and pass the serving policy
+// (security)
+func (s *Server) isValidPath(filePath string) bool {
+	return s.policy.allowed(filePath)
 }
 
 // handleStaticFile serves a static file from the root directory
@@ -216,6 +394,20 @@ func (s *Server) handleStaticFile(w http.ResponseWriter, r *http.Request, filePa
 	http.ServeFile(w, r, filePath)
 }
 
+// currentTheme returns the page theme used for rendering
+func (s *Server) currentTheme() string {
+	s.themeMu.RLock()
+	defer s.themeMu.RUnlock()
+	return s.theme
+}
+
+// setTheme changes the page theme for subsequent requests
+func (s *Server) setTheme(theme string) {
+	s.themeMu.Lock()
+	s.theme = theme
+	s.themeMu.Unlock()
+}
+
 // relPath returns a path relative to the root directory, or the original path if it's outside the root
 func (s *Server) relPath(path string) string {
 	rel, err := filepath.Rel(s.config.RootDir, path)
@@ -252,6 +444,8 @@ func getContentType(ext string) string {
 		return "image/webp"
 	case ".ico":
 		return "image/x-icon"
+	case ".woff2":
+		return "font/woff2"
 	default:
 		return "application/octet-stream"
 	}
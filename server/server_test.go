@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mdserver/certs"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStartTLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc.md"), []byte("# Secure\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	paths, err := certs.Ensure(filepath.Join(tmpDir, ".certs"), nil)
+	if err != nil {
+		t.Fatalf("certs.Ensure() error = %v", err)
+	}
+	port, err := findAvailablePort()
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+
+	srv := NewServer(Config{Host: "localhost", Port: port, RootDir: tmpDir, TLSCert: paths.Cert, TLSKey: paths.Key})
+	go srv.Start(context.Background())
+
+	caPEM, err := os.ReadFile(paths.CA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		Timeout:   2 * time.Second,
+	}
+
+	url := fmt.Sprintf("https://localhost:%d/doc.md", port)
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get(url); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Secure") {
+		t.Errorf("GET %s = %d, body %s", url, resp.StatusCode, body)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tmpDir := t.TempDir()
+	port, err := findAvailablePort()
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	srv := NewServer(Config{Host: "localhost", Port: port, RootDir: tmpDir, EnableLiveReload: true})
+
+	// A request that is still running when shutdown starts
+	inFlight := make(chan struct{})
+	srv.mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- srv.Start(ctx)
+	}()
+
+	baseURL := fmt.Sprintf("localhost:%d", port)
+	var conn *websocket.Conn
+	for i := 0; i < 50; i++ {
+		if conn, _, err = websocket.DefaultDialer.Dial("ws://"+baseURL+"/livereload", nil); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	defer conn.Close()
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + baseURL + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-inFlight
+	cancel()
+
+	if body := <-slow; body != "done" {
+		t.Errorf("In-flight request got %q, want it to finish", body)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("WebSocket client got %v, want a going away close frame", err)
+	}
+	select {
+	case err := <-startErr:
+		if err != nil {
+			t.Errorf("Start() error = %v", err)
+		}
+	case <-time.After(ShutdownTimeout):
+		t.Fatal("Start() didn't return after the context was cancelled")
+	}
+	if _, err := http.Get("http://" + baseURL + "/"); err == nil {
+		t.Error("Server still accepts connections after shutdown")
+	}
+}
+
+func TestShutdownFromSettings(t *testing.T) {
+	port, err := findAvailablePort()
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	srv := NewServer(Config{Host: "localhost", Port: port, RootDir: t.TempDir()})
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- srv.Start(context.Background())
+	}()
+
+	url := fmt.Sprintf("http://localhost:%d/settings/shutdown", port)
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = http.PostForm(url, neturl.Values{"csrf_token": {srv.csrfToken}}); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST %s = %d, want %d", url, resp.StatusCode, http.StatusOK)
+	}
+
+	select {
+	case err := <-startErr:
+		if err != nil {
+			t.Errorf("Start() error = %v", err)
+		}
+	case <-time.After(ShutdownTimeout):
+		t.Fatal("Start() didn't return after shutdown was requested")
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	templatefs "mdserver/template"
+)
+
+// templateFS serves template files from an optional override directory,
+// falling back to the templates embedded in the binary for any file the
+// override directory doesn't provide.
+type templateFS struct {
+	override fs.FS // nil when no override directory is configured
+}
+
+// newTemplateFS returns the template file system for the given override directory ("" for none)
+func newTemplateFS(overrideDir string) templateFS {
+	if overrideDir == "" {
+		return templateFS{}
+	}
+	return templateFS{override: os.DirFS(overrideDir)}
+}
+
+// Open implements fs.FS
+func (t templateFS) Open(name string) (fs.File, error) {
+	if t.override != nil {
+		f, err := t.override.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return templatefs.FS.Open(name)
+}
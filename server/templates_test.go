@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateFSEmbedded(t *testing.T) {
+	templates := newTemplateFS("")
+	for _, name := range []string{"page.html", "directory.html", "settings.html", "search.html", "style.css", "favicon.svg"} {
+		if _, err := fs.Stat(templates, name); err != nil {
+			t.Errorf("Expected embedded %s: %v", name, err)
+		}
+	}
+}
+
+func TestTemplateDirOverride(t *testing.T) {
+	rootDir := t.TempDir()
+	templateDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootDir, "doc.md"), []byte("# Doc\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	pageTemplate := filepath.Join(templateDir, "page.html")
+	if err := os.WriteFile(pageTemplate, []byte("<html><body>custom {{.Title}}</body></html>"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	srv := NewServer(Config{RootDir: rootDir, TemplateDir: templateDir})
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Body.String()
+	}
+
+	if body := get("/doc.md"); !strings.Contains(body, "custom Doc") {
+		t.Errorf("Expected overridden page template, got %s", body)
+	}
+
+	// Files not in the override directory come from the embedded templates
+	if body := get("/"); !strings.Contains(body, `class="directory-listing"`) {
+		t.Error("Expected embedded directory template")
+	}
+	if body := get("/assets/style.css"); !strings.Contains(body, "--bg-color") {
+		t.Error("Expected embedded stylesheet")
+	}
+
+	// Edits to an override file are picked up without a restart
+	if err := os.WriteFile(pageTemplate, []byte("<html><body>edited {{.Title}}</body></html>"), 0644); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(pageTemplate, later, later)
+	if body := get("/doc.md"); !strings.Contains(body, "edited Doc") {
+		t.Errorf("Expected edited page template, got %s", body)
+	}
+}
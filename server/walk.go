@@ -0,0 +1,39 @@
+package server
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// walkServed walks the tree at root like filepath.WalkDir, but only visits
+// what the server would serve: ignored directories, and directories that
+// allowed rejects, are skipped with everything below them, and such files are
+// left out. fn is called for root itself, whatever the rules say about it,
+// and can return filepath.SkipDir or an error to stop the walk. Unreadable
+// files and directories are skipped.
+func walkServed(root string, ignore *IgnoreMatcher, allowed func(path string) bool, fn func(path string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != root && (ignore.Ignored(path, d.IsDir()) || !allowed(path)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, d)
+	})
+}
+
+// walkServedMarkdown calls fn for every markdown file under root that the
+// server would serve, as walkServed decides. An error from fn stops the walk
+// and is returned.
+func walkServedMarkdown(root string, ignore *IgnoreMatcher, allowed func(path string) bool, fn func(path string) error) error {
+	return walkServed(root, ignore, allowed, func(path string, d fs.DirEntry) error {
+		if d.IsDir() || !isMarkdownFile(path) {
+			return nil
+		}
+		return fn(path)
+	})
+}
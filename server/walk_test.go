@@ -0,0 +1,44 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkServedMarkdown(t *testing.T) {
+	base := t.TempDir()
+	rootDir := filepath.Join(base, "docs")
+	writeFiles(t, rootDir, map[string]string{
+		"README.md":        "# Home\n",
+		"guide.md":         "# Guide\n",
+		"image.png":        "png",
+		"drafts/a.md":      "# A\n",
+		"private/b.md":     "# B\n",
+		".hidden/c.md":     "# C\n",
+		"vendor/notes.md":  "# Notes\n",
+		".mdserverignore":  "drafts/\n",
+		"sub/deeper/d.md":  "# D\n",
+		"sub/deeper/x.txt": "x",
+	})
+	writeFiles(t, base, map[string]string{"outside/secret.md": "# Secret\n"})
+	if err := os.Symlink(filepath.Join(base, "outside", "secret.md"), filepath.Join(rootDir, "leak.md")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	config := Config{RootDir: rootDir, DenyPatterns: []string{"private/"}, FollowSymlinks: true}
+
+	var got []string
+	err := walkServedMarkdown(rootDir, NewIgnoreMatcher(rootDir, nil), newServePolicy(config).allowed, func(path string) error {
+		rel, _ := filepath.Rel(rootDir, path)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkServedMarkdown() error = %v", err)
+	}
+	want := []string{"README.md", "guide.md", "sub/deeper/d.md", "vendor/notes.md"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walkServedMarkdown() visited %v, want %v", got, want)
+	}
+}
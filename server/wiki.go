@@ -0,0 +1,188 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"mdserver/renderer"
+)
+
+// WikiIndex maps page names to the markdown files under a root directory, for
+// resolving [[wiki links]]. A page is named by its path relative to the root,
+// its file name or its title, without the .md extension and ignoring case.
+// It is built lazily on the first lookup and kept current through Update.
+type WikiIndex struct {
+	rootDir string
+	ignore  *IgnoreMatcher
+	allowed func(path string) bool // Serving policy; other files can't be linked to
+	mu      sync.RWMutex
+	built   bool
+	titles  map[string]string // absolute path -> title ("" if none)
+}
+
+// NewWikiIndex creates an empty index for rootDir. Files matched by ignore,
+// and files the server wouldn't serve according to allowed, can't be linked to.
+func NewWikiIndex(rootDir string, ignore *IgnoreMatcher, allowed func(path string) bool) *WikiIndex {
+	return &WikiIndex{
+		rootDir: rootDir,
+		ignore:  ignore,
+		allowed: allowed,
+		titles:  make(map[string]string),
+	}
+}
+
+// ensureBuilt indexes every markdown file under the root directory if that hasn't been done yet
+func (w *WikiIndex) ensureBuilt() {
+	w.mu.RLock()
+	built := w.built
+	w.mu.RUnlock()
+	if built {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.built {
+		return
+	}
+	w.indexTree(w.rootDir)
+	w.built = true
+}
+
+// indexTree adds all markdown files under dir and reports whether any were
+// new. Caller must hold the write lock.
+func (w *WikiIndex) indexTree(dir string) bool {
+	changed := false
+	walkServedMarkdown(dir, w.ignore, w.allowed, func(path string) error {
+		changed = w.indexFile(path) || changed
+		return nil
+	})
+	return changed
+}
+
+// indexFile (re)reads the title of a markdown file and reports whether the
+// file was new or its title changed. Caller must hold the write lock.
+func (w *WikiIndex) indexFile(path string) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return w.removeFile(path)
+	}
+	title := renderer.Title(content)
+	old, ok := w.titles[path]
+	w.titles[path] = title
+	return !ok || old != title
+}
+
+// removeFile drops path and any files below it, and reports whether there
+// were any. Caller must hold the write lock.
+func (w *WikiIndex) removeFile(path string) bool {
+	_, changed := w.titles[path]
+	delete(w.titles, path)
+	prefix := path + string(filepath.Separator)
+	for page := range w.titles {
+		if strings.HasPrefix(page, prefix) {
+			delete(w.titles, page)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Update refreshes the index for a changed path and reports whether links
+// may now resolve differently: a page was added, removed or retitled, or an
+// ignore file changed.
+func (w *WikiIndex) Update(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.built {
+		// Nothing has been resolved yet; the first lookup reads everything
+		return false
+	}
+
+	path = filepath.Clean(path)
+	if isIgnoreFile(filepath.Base(path)) {
+		w.titles = make(map[string]string)
+		w.built = false
+		return true
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err != nil, !w.allowed(path):
+		return w.removeFile(path)
+	case info.IsDir():
+		if w.ignore.Ignored(path, true) {
+			return false
+		}
+		return w.indexTree(path)
+	case isMarkdownFile(path) && !w.ignore.Ignored(path, false):
+		return w.indexFile(path)
+	}
+	return false
+}
+
+// Resolve returns the markdown file a wiki link from the page at from names.
+// File paths and names are matched before titles. Among several matches, one
+// in the linking page's directory is preferred, then the least deeply nested.
+func (w *WikiIndex) Resolve(page, from string) (string, bool) {
+	w.ensureBuilt()
+
+	key := strings.ToLower(strings.TrimPrefix(filepath.ToSlash(page), "/"))
+	if isMarkdownFile(key) {
+		key = strings.TrimSuffix(key, filepath.Ext(key))
+	}
+
+	w.mu.RLock()
+	var byName, byTitle []string
+	for path, title := range w.titles {
+		rel, err := filepath.Rel(w.rootDir, path)
+		if err != nil {
+			continue
+		}
+		rel = strings.ToLower(filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))))
+		switch {
+		case rel == key || strings.HasSuffix(rel, "/"+key):
+			byName = append(byName, path)
+		case strings.EqualFold(title, page):
+			byTitle = append(byTitle, path)
+		}
+	}
+	w.mu.RUnlock()
+
+	matches := byName
+	if len(matches) == 0 {
+		matches = byTitle
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	fromDir := filepath.Dir(from)
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if sameA, sameB := filepath.Dir(a) == fromDir, filepath.Dir(b) == fromDir; sameA != sameB {
+			return sameA
+		}
+		if depthA, depthB := strings.Count(a, string(filepath.Separator)), strings.Count(b, string(filepath.Separator)); depthA != depthB {
+			return depthA < depthB
+		}
+		return a < b
+	})
+	return matches[0], true
+}
+
+// Resolver returns the renderer.WikiResolver for links on the page at from
+func (w *WikiIndex) Resolver(from string) renderer.WikiResolver {
+	return func(page string) (string, bool) {
+		path, ok := w.Resolve(page, from)
+		if !ok {
+			return "", false
+		}
+		rel, err := filepath.Rel(w.rootDir, path)
+		if err != nil {
+			return "", false
+		}
+		return urlFromRelPath(rel), true
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWikiIndexResolve(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md":             "# Home\n",
+		"docs/guide.md":         "# User Guide\n",
+		"notes/guide.md":        "# Note Guide\n",
+		"notes/today.md":        "Today\n",
+		"team/Meeting Notes.md": "---\ntitle: Weekly Sync\n---\n# Agenda\n",
+		".hidden/secret.md":     "# Secret\n",
+		"image.png":             "png",
+	})
+	w := NewWikiIndex(tmpDir, NewIgnoreMatcher(tmpDir, nil), newServePolicy(Config{RootDir: tmpDir}).allowed)
+	readme := filepath.Join(tmpDir, "README.md")
+
+	tests := []struct {
+		page string
+		from string
+		want string // Relative path, "" if unresolved
+	}{
+		{"README", readme, "README.md"},
+		{"guide", readme, "docs/guide.md"},
+		{"guide", filepath.Join(tmpDir, "notes", "today.md"), "notes/guide.md"},
+		{"notes/guide", readme, "notes/guide.md"},
+		{"/docs/guide.md", readme, "docs/guide.md"},
+		{"Guide.md", readme, "docs/guide.md"},
+		{"user guide", readme, "docs/guide.md"},
+		{"Weekly Sync", readme, "team/Meeting Notes.md"},
+		{"meeting notes", readme, "team/Meeting Notes.md"},
+		{"Agenda", readme, ""},
+		{"secret", readme, ""},
+		{"image", readme, ""},
+		{"missing", readme, ""},
+	}
+	for _, tt := range tests {
+		path, ok := w.Resolve(tt.page, tt.from)
+		got := ""
+		if ok {
+			got, _ = filepath.Rel(tmpDir, path)
+			got = filepath.ToSlash(got)
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q) from %s = %q, want %q", tt.page, filepath.Base(tt.from), got, tt.want)
+		}
+	}
+
+	if href, ok := w.Resolver(readme)("Weekly Sync"); !ok || href != "/team/Meeting%20Notes.md" {
+		t.Errorf("Resolver() = %q, %t", href, ok)
+	}
+}
+
+func TestWikiIndexUpdate(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{"README.md": "# Home\n"})
+	w := NewWikiIndex(tmpDir, NewIgnoreMatcher(tmpDir, nil), newServePolicy(Config{RootDir: tmpDir}).allowed)
+	readme := filepath.Join(tmpDir, "README.md")
+
+	if _, ok := w.Resolve("plan", readme); ok {
+		t.Fatal("plan shouldn't resolve before it exists")
+	}
+
+	plan := filepath.Join(tmpDir, "docs", "plan.md")
+	writeFiles(t, tmpDir, map[string]string{"docs/plan.md": "# Roadmap\n"})
+	if !w.Update(filepath.Join(tmpDir, "docs")) {
+		t.Error("Update() should report a created directory with pages")
+	}
+	if _, ok := w.Resolve("plan", readme); !ok {
+		t.Error("plan should resolve once created")
+	}
+	if _, ok := w.Resolve("roadmap", readme); !ok {
+		t.Error("plan should resolve by its title")
+	}
+
+	writeFiles(t, tmpDir, map[string]string{"docs/plan.md": "# Roadmap\n\nMore text.\n"})
+	if w.Update(plan) {
+		t.Error("Update() shouldn't report an edit that keeps the title")
+	}
+	writeFiles(t, tmpDir, map[string]string{"docs/plan.md": "# Next Steps\n"})
+	if !w.Update(plan) {
+		t.Error("Update() should report a changed title")
+	}
+	if _, ok := w.Resolve("roadmap", readme); ok {
+		t.Error("The old title shouldn't resolve")
+	}
+
+	writeFiles(t, tmpDir, map[string]string{"notes.txt": "text"})
+	if w.Update(filepath.Join(tmpDir, "notes.txt")) {
+		t.Error("Update() shouldn't report files that aren't markdown")
+	}
+
+	if err := os.RemoveAll(filepath.Join(tmpDir, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Update(filepath.Join(tmpDir, "docs")) {
+		t.Error("Update() should report a removed directory with pages")
+	}
+	if _, ok := w.Resolve("plan", readme); ok {
+		t.Error("plan shouldn't resolve once removed")
+	}
+}
+
+func TestWikiIndexServingPolicy(t *testing.T) {
+	config := writeUnservedFixtures(t)
+	srv := NewServer(config)
+	readme := filepath.Join(config.RootDir, "README.md")
+
+	for _, page := range []string{"leak", "Secret", "plan", "private/plan"} {
+		if path, ok := srv.wiki.Resolve(page, readme); ok {
+			t.Errorf("Resolve(%q) = %s, want no page", page, path)
+		}
+	}
+	if _, ok := srv.wiki.Resolve("guide", readme); !ok {
+		t.Error("Expected served pages to resolve")
+	}
+}
+
+func TestServeWikiLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"README.md":     "# Home\n\nRead [[guide#Install it]], [[Team Notes|the notes]] and [[Roadmap]].\n",
+		"docs/guide.md": "# Guide\n\n## Install it\n",
+	})
+	srv := NewServer(Config{RootDir: tmpDir})
+	get := func() string {
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/README.md", nil))
+		return rec.Body.String()
+	}
+
+	html := get()
+	for _, want := range []string{
+		`<a class="wikilink" href="/docs/guide.md#install-it">guide &gt; Install it</a>`,
+		`<span class="wikilink wikilink-missing" title="No page named Team Notes">the notes</span>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected %s in page", want)
+		}
+	}
+
+	// A page created later turns cached missing links into links
+	writeFiles(t, tmpDir, map[string]string{"Team Notes.md": "# Notes\n"})
+	srv.updateWikiIndex(filepath.Join(tmpDir, "Team Notes.md"))
+	if html := get(); !strings.Contains(html, `<a class="wikilink" href="/Team%20Notes.md">the notes</a>`) {
+		t.Error("Expected the link to resolve after the page was created")
+	}
+
+	// Exported pages link to the exported files
+	outDir := t.TempDir()
+	if _, err := srv.Export(outDir); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	exported, err := os.ReadFile(filepath.Join(outDir, "README.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(exported), `href="docs/guide.html#install-it"`) {
+		t.Errorf("Expected the exported wiki link to point at docs/guide.html, got %s", exported)
+	}
+}
@@ -0,0 +1,10 @@
+// Package template embeds the default HTML templates, stylesheet and favicon
+// into the binary.
+package template
+
+import "embed"
+
+// FS holds the default template files.
+//
+//go:embed *.html *.css *.svg
+var FS embed.FS